@@ -0,0 +1,303 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mitchellh/cli"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const defaultInitPath = ".janitor.yml"
+
+var initTemplate = template.Must(template.New("init").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`# janitor config, see janitor config schema for every field
+# ${NAME} is replaced with the env variable NAME (empty if it isn't set, config validate warns about it) so
+# that tokens stay out of the file, flags and env variables of the commands take precedence over the config
+tracker:
+  # merged with the built-in rules below, a rule with the same name as a built-in replaces it, e.g.
+  #   - name: internal-token
+  #     regexps:
+  #       - "itk_[0-9a-zA-Z]{32}"
+  #     keyword: internal # optional, has to be present on the same line
+  #     severity: high # low, medium, high or critical
+  #     entropy: 3.5 # optional, overrides the minimum entropy for matching candidates
+  rules: []
+  # the built-in rules, add their names to disable them:
+{{- range .}}
+  #   {{.Name}} ({{if .Severity}}{{.Severity}}{{else}}medium{{end}}{{if .Keyword}}, keyword {{.Keyword}}{{end}}):{{range .Regexps}} {{quote .}}{{end}}
+{{- end}}
+  disabledRules: []
+  # increase the entropy of candidates on lines containing a keyword or in files with a matching name
+  keywords:
+    - config
+    - vault
+    - password
+    - secret
+    - client_secret
+    - access_key
+    - secret_key
+  fileNames:
+    - ".pem"
+    - ".credentials"
+    - "passwd"
+    - ".secret"
+    - "config"
+  # .gitignore syntax, .gitignore and .janitorignore files found in the tree are honoured as well
+  whitelist:
+    - .git/
+  # base urls of the apis used by -verify, the public apis are used when left out
+  verify: {}
+  # zip (jar, whl, ...), tar, gzip and bzip2 are scanned entry by entry
+  archives:
+    maxDepth: 3 # every layer counts, a .tar.gz is 2, 0 disables scanning archives
+    maxSize: 104857600 # max bytes extracted from a single entry
+  # limits for urls given as targets or with -urls-file
+  remote:
+    timeout: 30s
+    maxSize: 10485760
+tfa:
+  github:
+    apiKey: ${GITHUB_KEY}
+    organization: ${GITHUB_ORG}
+    enforce:
+      graceDays: 14
+      stateFile: .janitor-tfa-state.json
+  gsuite:
+    keyFile: ${GSUITE_KEY} # path to the json key of the service account
+    subject: ${GSUITE_SUBJECT}
+  gitlab:
+    token: ${GITLAB_TOKEN}
+    baseUrl: ${GITLAB_URL} # https://gitlab.com/ when empty
+  slack:
+    token: ${SLACK_TOKEN}
+  okta:
+    token: ${OKTA_TOKEN}
+    baseUrl: ${OKTA_URL}
+  bitbucket:
+    token: ${BITBUCKET_TOKEN}
+    workspace: ${BITBUCKET_WORKSPACE}
+  historyFile: .janitor-tfa-history.jsonl
+domain:
+  # checked when no -host is given
+  hosts: []
+mining:
+  # names of the directories that are skipped
+  ignore:
+    - vendor
+    - .git
+    - node_modules
+`))
+
+type ConfigCommand struct {
+	Ui cli.Ui
+	// BuiltinRules are written by init, they live in the tracker
+	BuiltinRules []Rule
+}
+
+func (c *ConfigCommand) Run(args []string) int {
+	config := cli.NewCLI("config", "")
+	config.Args = args
+
+	config.Commands = map[string]cli.CommandFactory{
+		"validate": func() (cli.Command, error) {
+			return &ValidateCommand{Ui: c.Ui}, nil
+		},
+		"init": func() (cli.Command, error) {
+			return &InitCommand{Ui: c.Ui, BuiltinRules: c.BuiltinRules}, nil
+		},
+		"schema": func() (cli.Command, error) {
+			return &SchemaCommand{Ui: c.Ui}, nil
+		},
+	}
+
+	exitStatus, err := config.Run()
+	if err != nil {
+		c.Ui.Error(err.Error())
+	}
+	return exitStatus
+}
+
+func (c *ConfigCommand) Help() string {
+	helpText := `
+		Usage: janitor config <validate/init/schema>
+		  Validates the config, writes a new one with the defaults or prints its JSON Schema
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConfigCommand) Synopsis() string {
+	return "Validate, create or describe the config"
+}
+
+type ValidateCommand struct {
+	Ui cli.Ui
+}
+
+func (v *ValidateCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("validate", flag.ExitOnError)
+	cmdFlags.Usage = func() { v.Ui.Output(v.Help()) }
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	path := cmdFlags.Arg(0)
+	if path == "" {
+		path = FindConfig()
+		if path == "" {
+			v.Ui.Error(fmt.Sprintf("CRITICAL: No config found in %s", strings.Join(SearchPaths(), " or ")))
+			return 1
+		}
+	}
+
+	problems, err := ValidateFile(path)
+	if err != nil {
+		v.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+	invalid := 0
+	for _, problem := range problems {
+		location := path
+		if problem.Line > 0 {
+			location = fmt.Sprintf("%s:%d", path, problem.Line)
+		}
+		if problem.Warning {
+			v.Ui.Warn(fmt.Sprintf("WARNING: %s: %s", location, problem))
+			continue
+		}
+		v.Ui.Error(fmt.Sprintf("%s: %s", location, problem))
+		invalid++
+	}
+
+	if invalid == 0 {
+		v.Ui.Info(fmt.Sprintf("OK: %s is valid", path))
+		return 0
+	}
+	v.Ui.Error(fmt.Sprintf("CRITICAL: %d problems in %s", invalid, path))
+	return 1
+}
+
+func (v *ValidateCommand) Help() string {
+	helpText := `
+		Usage: janitor config validate [path]
+		  Validates the config, defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml. Every problem
+		  is reported with its line, unknown fields included. References to env variables that aren't set are
+		  only warnings, a provider without its token is left out. The commands only validate their own
+		  section when loading the config and leave out the values that require another one, e.g.
+		  tfa.github.organization, since flags can provide it
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (v *ValidateCommand) Synopsis() string {
+	return "Validate the config"
+}
+
+type InitCommand struct {
+	Ui           cli.Ui
+	BuiltinRules []Rule
+}
+
+func (i *InitCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("init", flag.ExitOnError)
+	cmdFlags.Usage = func() { i.Ui.Output(i.Help()) }
+	force := false
+	cmdFlags.BoolVar(&force, "force", false, "Overwrite an existing config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	path := cmdFlags.Arg(0)
+	if path == "" {
+		path = defaultInitPath
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0600)
+	if os.IsExist(err) {
+		i.Ui.Error(fmt.Sprintf("CRITICAL: %s already exists, use -force to overwrite it", path))
+		return 1
+	}
+	if err != nil {
+		i.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	err = initTemplate.Execute(file, i.BuiltinRules)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		i.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	i.Ui.Info(fmt.Sprintf("OK: Wrote %s", path))
+	return 0
+}
+
+func (i *InitCommand) Help() string {
+	helpText := `
+		Usage: janitor config init [path]
+		  Writes a config with the defaults and the built-in rules as comments, defaults to ./.janitor.yml
+		Options:
+		  -force overwrite an existing config
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (i *InitCommand) Synopsis() string {
+	return "Write a config with the defaults"
+}
+
+type SchemaCommand struct {
+	Ui cli.Ui
+	// Out receives the schema, defaults to stdout
+	Out io.Writer
+}
+
+func (s *SchemaCommand) out() io.Writer {
+	if s.Out == nil {
+		return os.Stdout
+	}
+	return s.Out
+}
+
+func (s *SchemaCommand) Run(args []string) int {
+	schema, err := json.MarshalIndent(JSONSchema(), "", "  ")
+	if err != nil {
+		s.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+	fmt.Fprintln(s.out(), string(schema))
+	return 0
+}
+
+func (s *SchemaCommand) Help() string {
+	helpText := `
+		Usage: janitor config schema
+		  Prints the JSON Schema of the config, e.g. for editors to validate and complete it. With the yaml
+		  language server: # yaml-language-server: $schema=<path to the schema>
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (s *SchemaCommand) Synopsis() string {
+	return "Print the JSON Schema of the config"
+}
@@ -0,0 +1,110 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Commands", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-config-command")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("writes a config with the built-in rules that passes validation", func() {
+		path := filepath.Join(dir, "janitor.yml")
+		init := &config.InitCommand{Ui: cli.NewMockUi(), BuiltinRules: tracker.BuiltinRules}
+		Expect(init.Run([]string{path})).To(Equal(0))
+		Expect(init.Run([]string{path})).To(Equal(1))
+		Expect(init.Run([]string{"-force", path})).To(Equal(0))
+
+		written, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(written)).To(ContainSubstring(`#   slack (high, keyword slack): "xoxb-[0-9a-zA-Z-]{10,}"`))
+
+		os.Unsetenv("SLACK_TOKEN")
+		ui := cli.NewMockUi()
+		Expect((&config.ValidateCommand{Ui: ui}).Run([]string{path})).To(Equal(0))
+		Expect(ui.OutputWriter.String()).To(ContainSubstring("OK: "))
+		Expect(ui.ErrorWriter.String()).To(MatchRegexp(`WARNING: .*:\d+: tfa\.slack\.token: env variable SLACK_TOKEN isn't set`))
+	})
+
+	It("validates the sample config", func() {
+		ui := cli.NewMockUi()
+		Expect((&config.ValidateCommand{Ui: ui}).Run([]string{"config.yml"})).To(Equal(0))
+		Expect(ui.OutputWriter.String()).To(ContainSubstring("OK: config.yml is valid"))
+	})
+
+	It("reports every problem with its line", func() {
+		path := filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(path, []byte(`tracker:
+  rules:
+    - name: ok
+      regexps: ["ok_[a-z]+"]
+    - name: broken
+      regexps:
+        - "([a-z"
+      severity: urgent
+tfa:
+  github:
+    apikey: secret
+  okta:
+    token: secret
+domain:
+  hosts:
+    - example.com
+    - https://example.com
+`), 0600)).To(Succeed())
+
+		ui := cli.NewMockUi()
+		Expect((&config.ValidateCommand{Ui: ui}).Run([]string{path})).To(Equal(1))
+		errors := ui.ErrorWriter.String()
+		Expect(errors).To(ContainSubstring(path + `:5: tracker.rules[1] (broken): invalid regexp "([a-z"`))
+		Expect(errors).To(ContainSubstring(path + `:5: tracker.rules[1] (broken): unknown severity "urgent"`))
+		Expect(errors).To(ContainSubstring(path + ":11: field apikey not found in type config.GitHub"))
+		Expect(errors).To(ContainSubstring(path + ":12: tfa.okta.baseUrl: is required when token is set"))
+		Expect(errors).To(ContainSubstring(path + ":17: domain.hosts[1]: must be a host"))
+		Expect(errors).To(ContainSubstring("CRITICAL: 5 problems in " + path))
+	})
+
+	It("reports the line of a yaml error", func() {
+		path := filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(path, []byte("tracker:\n  rules: [\n"), 0600)).To(Succeed())
+
+		problems, err := config.ValidateFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0].Line).To(BeNumerically(">", 0))
+	})
+
+	It("describes the config as a JSON Schema", func() {
+		out := &bytes.Buffer{}
+		Expect((&config.SchemaCommand{Ui: cli.NewMockUi(), Out: out}).Run(nil)).To(Equal(0))
+
+		var schema config.Schema
+		Expect(json.Unmarshal(out.Bytes(), &schema)).To(Succeed())
+		Expect(schema.Properties).To(HaveKey("tfa"))
+		Expect(*schema.AdditionalProperties).To(BeFalse())
+
+		rule := schema.Properties["tracker"].Properties["rules"].Items
+		Expect(rule.Properties["severity"].Enum).To(Equal([]string{"low", "medium", "high", "critical"}))
+		Expect(rule.Properties["entropy"].Type).To(Equal("number"))
+		Expect(schema.Properties["tracker"].Properties["remote"].Properties["timeout"].Type).To(Equal("string"))
+		Expect(schema.Properties["tfa"].Properties["github"].Properties["enforce"].Properties).To(HaveKey("graceDays"))
+	})
+})
@@ -1,12 +1,96 @@
 package config
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 )
 
+var severities = []string{"low", "medium", "high", "critical"}
+
+// envReference only matches the braced form, a bare $ is common in the regexps of the rules
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
 type Config struct {
 	Tracker Tracker `yaml:"tracker"`
+	Tfa     Tfa     `yaml:"tfa"`
+	Domain  Domain  `yaml:"domain"`
+	Mining  Mining  `yaml:"mining"`
+}
+
+// Tfa configures the providers, flags and env variables take precedence over the config
+type Tfa struct {
+	GitHub    GitHub    `yaml:"github"`
+	Gsuite    Gsuite    `yaml:"gsuite"`
+	Gitlab    Gitlab    `yaml:"gitlab"`
+	Slack     Slack     `yaml:"slack"`
+	Okta      Okta      `yaml:"okta"`
+	Bitbucket Bitbucket `yaml:"bitbucket"`
+	// HistoryFile records the runs of tfa all, defaults to .janitor-tfa-history.jsonl
+	HistoryFile string `yaml:"historyFile"`
+}
+
+type GitHub struct {
+	ApiKey       string  `yaml:"apiKey"`
+	Organization string  `yaml:"organization"`
+	BaseUrl      string  `yaml:"baseUrl"`
+	Enforce      Enforce `yaml:"enforce"`
+}
+
+// Enforce configures tfa github -enforce
+type Enforce struct {
+	// GraceDays defaults to 14
+	GraceDays int `yaml:"graceDays"`
+	// StateFile defaults to .janitor-tfa-state.json
+	StateFile string `yaml:"stateFile"`
+	// IssueRepo is owner/repo, accounts are notified in an issue there and enforcing requires it
+	IssueRepo string `yaml:"issueRepo"`
+}
+
+type Gsuite struct {
+	// KeyFile is the path to the json key of the service account
+	KeyFile string `yaml:"keyFile"`
+	Subject string `yaml:"subject"`
+	OrgUnit string `yaml:"orgUnit"`
+	BaseUrl string `yaml:"baseUrl"`
+}
+
+type Gitlab struct {
+	Token   string `yaml:"token"`
+	BaseUrl string `yaml:"baseUrl"`
+}
+
+type Slack struct {
+	Token   string `yaml:"token"`
+	BaseUrl string `yaml:"baseUrl"`
+}
+
+type Okta struct {
+	Token   string `yaml:"token"`
+	BaseUrl string `yaml:"baseUrl"`
+}
+
+type Bitbucket struct {
+	Token     string `yaml:"token"`
+	Workspace string `yaml:"workspace"`
+	BaseUrl   string `yaml:"baseUrl"`
+}
+
+type Domain struct {
+	// Hosts are checked when no host is given on the command line, host[:port] [starttls=<protocol>] [sni=<name>]
+	Hosts []string `yaml:"hosts"`
+}
+
+type Mining struct {
+	// Ignore are the names of the directories that are skipped, defaults to vendor, .git and node_modules
+	Ignore []string `yaml:"ignore"`
 }
 
 type Tracker struct {
@@ -14,8 +98,50 @@ type Tracker struct {
 	FileNames []string `yaml:"fileNames"`
 	RepoPath  string   `yaml:"repoPath"`
 	WhiteList []string `yaml:"whitelist"`
+	// Rules are merged with the built-in rules, a rule with the same name as a built-in replaces it
+	Rules         []Rule   `yaml:"rules"`
+	DisabledRules []string `yaml:"disabledRules"`
+	Verify        Verify   `yaml:"verify"`
+	Archives      Archives `yaml:"archives"`
+	Remote        Remote   `yaml:"remote"`
 }
 
+// Remote limits fetching urls to scan
+type Remote struct {
+	// Timeout of the whole request, defaults to 30s
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxSize is the max number of bytes read from the body, defaults to 10mb
+	MaxSize int64 `yaml:"maxSize"`
+}
+
+type Archives struct {
+	// MaxDepth is how many archives deep to descend, every layer counts, a .tar.gz is 2. Defaults to 3 when
+	// unset, 0 (or -1) disables scanning archives
+	MaxDepth *int `yaml:"maxDepth"`
+	// MaxSize is the max number of bytes extracted from a single entry, defaults to 100mb
+	MaxSize int64 `yaml:"maxSize"`
+}
+
+// Verify holds the base urls of the apis used by -verify, the public apis are used when empty
+type Verify struct {
+	GitHub string `yaml:"github"`
+	Slack  string `yaml:"slack"`
+	AWS    string `yaml:"aws"`
+	Google string `yaml:"google"`
+}
+
+type Rule struct {
+	Name    string   `yaml:"name"`
+	Regexps []string `yaml:"regexps"`
+	// Keyword has to be present on the same line for the rule to match (optional)
+	Keyword  string `yaml:"keyword"`
+	Severity string `yaml:"severity"`
+	// Entropy overrides the minimum entropy for candidates matching the rule (optional)
+	Entropy *float64 `yaml:"entropy"`
+}
+
+// LoadConfig reads the config at path, ${ENV_VAR} in any string is replaced with the value of the env
+// variable (empty if it isn't set) so that tokens don't have to be written to disk
 func LoadConfig(path string) (*Config, error) {
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -25,12 +151,301 @@ func LoadConfig(path string) (*Config, error) {
 	var cfg Config
 	err = yaml.Unmarshal(file, &cfg)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %s", path, err)
 	}
 
+	interpolate(reflect.ValueOf(&cfg).Elem(), "", &Problems{})
 	return &cfg, nil
 }
 
+// SearchPaths are where the config is looked for when no path is given, in order
+func SearchPaths() []string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+
+	paths := []string{".janitor.yml"}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "janitor", "config.yml"))
+	}
+	return paths
+}
+
+// FindConfig returns the first of SearchPaths that exists, empty if none does
+func FindConfig() string {
+	for _, path := range SearchPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadDefaultConfig loads path, or the first config found in SearchPaths if path is empty. Without a
+// config an empty one is returned, every command works with flags and env variables alone. Only the
+// section of the command (tracker, tfa, domain or mining) is validated, and without the checks across
+// fields that flags can complete, config validate has those
+func LoadDefaultConfig(path string, section string) (*Config, error) {
+	if path == "" {
+		path = FindConfig()
+	}
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateSection(*cfg, section); err != nil {
+		return nil, fmt.Errorf("%s:\n%s", path, err)
+	}
+	return cfg, nil
+}
+
+// interpolate replaces the env references in every string of the value at the yaml path, a reference to
+// an env variable that isn't set is a warning, it's either a typo or a provider that isn't used
+func interpolate(value reflect.Value, path string, problems *Problems) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(envReference.ReplaceAllStringFunc(value.String(), func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				problems.warn(path, "env variable %s isn't set", name)
+			}
+			return env
+		}))
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			name := strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			if path != "" {
+				name = path + "." + name
+			}
+			interpolate(value.Field(i), name, problems)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			interpolate(value.Index(i), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Ptr:
+		if !value.IsNil() {
+			interpolate(value.Elem(), path, problems)
+		}
+	}
+}
+
+// Problem is something wrong with the value at the yaml path
+type Problem struct {
+	Path    string
+	Message string
+	// Line is only known for problems found by ValidateFile
+	Line int
+	// Warning is reported but doesn't make the config invalid
+	Warning bool
+}
+
+func (problem Problem) String() string {
+	if problem.Path == "" {
+		return problem.Message
+	}
+	return fmt.Sprintf("%s: %s", problem.Path, problem.Message)
+}
+
+// Problems is the error returned by Validate, one problem per line
+type Problems []Problem
+
+func (problems Problems) Error() string {
+	var lines []string
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (problems *Problems) add(path string, format string, args ...interface{}) {
+	*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (problems *Problems) warn(path string, format string, args ...interface{}) {
+	*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// Validate returns Problems with everything that is wrong in the config, nil if nothing is
 func Validate(config Config) error {
+	problems := Problems{}
+	validateTracker(config.Tracker, &problems)
+	validateTfa(config.Tfa, &problems)
+	validateTfaPairs(config.Tfa, &problems)
+	validateDomain(config.Domain, &problems)
+	validateMining(config.Mining, &problems)
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ValidateSection returns Problems with the values of a section that are wrong on their own, a value that
+// requires another one isn't checked since flags can provide it
+func ValidateSection(config Config, section string) error {
+	problems := Problems{}
+	switch section {
+	case "tracker":
+		validateTracker(config.Tracker, &problems)
+	case "tfa":
+		validateTfa(config.Tfa, &problems)
+	case "domain":
+		validateDomain(config.Domain, &problems)
+	case "mining":
+		validateMining(config.Mining, &problems)
+	default:
+		return fmt.Errorf("unknown section %q", section)
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
 	return nil
 }
+
+func validateTracker(tracker Tracker, problems *Problems) {
+	if tracker.Archives.MaxDepth != nil && *tracker.Archives.MaxDepth < -1 {
+		problems.add("tracker.archives.maxDepth", "must be -1 or more, got %d", *tracker.Archives.MaxDepth)
+	}
+	if tracker.Archives.MaxSize < 0 {
+		problems.add("tracker.archives.maxSize", "must be positive, got %d", tracker.Archives.MaxSize)
+	}
+	if tracker.Remote.Timeout < 0 {
+		problems.add("tracker.remote.timeout", "must be positive, got %s", tracker.Remote.Timeout)
+	}
+	if tracker.Remote.MaxSize < 0 {
+		problems.add("tracker.remote.maxSize", "must be positive, got %d", tracker.Remote.MaxSize)
+	}
+
+	validateUrl("tracker.verify.github", tracker.Verify.GitHub, problems)
+	validateUrl("tracker.verify.slack", tracker.Verify.Slack, problems)
+	validateUrl("tracker.verify.aws", tracker.Verify.AWS, problems)
+	validateUrl("tracker.verify.google", tracker.Verify.Google, problems)
+
+	validateRules(tracker.Rules, problems)
+}
+
+func validateRules(rules []Rule, problems *Problems) {
+	names := map[string]bool{}
+	for i, rule := range rules {
+		path := fmt.Sprintf("tracker.rules[%d]", i)
+		if rule.Name == "" {
+			problems.add(path, "name is required")
+		} else {
+			path = fmt.Sprintf("%s (%s)", path, rule.Name)
+			if names[rule.Name] {
+				problems.add(path, "duplicate rule name")
+			}
+			names[rule.Name] = true
+		}
+
+		if len(rule.Regexps) == 0 {
+			problems.add(path, "at least one regexp is required")
+		}
+		for _, expr := range rule.Regexps {
+			if _, err := regexp.Compile(expr); err != nil {
+				problems.add(path, "invalid regexp %q: %s", expr, err)
+			}
+		}
+
+		if rule.Severity != "" && !contains(severities, rule.Severity) {
+			problems.add(path, "unknown severity %q, expected one of %v", rule.Severity, severities)
+		}
+
+		if rule.Entropy != nil && (*rule.Entropy < 0 || *rule.Entropy > 8) {
+			problems.add(path, "entropy must be between 0 and 8, got %v", *rule.Entropy)
+		}
+	}
+}
+
+func validateTfa(tfa Tfa, problems *Problems) {
+	validateUrl("tfa.github.baseUrl", tfa.GitHub.BaseUrl, problems)
+	if tfa.GitHub.Enforce.GraceDays < 0 {
+		problems.add("tfa.github.enforce.graceDays", "must be positive, got %d", tfa.GitHub.Enforce.GraceDays)
+	}
+	if repo := tfa.GitHub.Enforce.IssueRepo; repo != "" && len(strings.Split(repo, "/")) != 2 {
+		problems.add("tfa.github.enforce.issueRepo", "must be owner/repo, got %q", repo)
+	}
+
+	validateUrl("tfa.gsuite.baseUrl", tfa.Gsuite.BaseUrl, problems)
+	if tfa.Gsuite.OrgUnit != "" && !strings.HasPrefix(tfa.Gsuite.OrgUnit, "/") {
+		problems.add("tfa.gsuite.orgUnit", "must start with /, got %q", tfa.Gsuite.OrgUnit)
+	}
+
+	validateUrl("tfa.gitlab.baseUrl", tfa.Gitlab.BaseUrl, problems)
+	validateUrl("tfa.slack.baseUrl", tfa.Slack.BaseUrl, problems)
+	validateUrl("tfa.okta.baseUrl", tfa.Okta.BaseUrl, problems)
+	validateUrl("tfa.bitbucket.baseUrl", tfa.Bitbucket.BaseUrl, problems)
+}
+
+// validateTfaPairs checks the values of the providers that only work together, e.g. a token without the
+// organization it's for
+func validateTfaPairs(tfa Tfa, problems *Problems) {
+	requireBoth("tfa.github", "apiKey", tfa.GitHub.ApiKey, "organization", tfa.GitHub.Organization, problems)
+	requireBoth("tfa.gsuite", "keyFile", tfa.Gsuite.KeyFile, "subject", tfa.Gsuite.Subject, problems)
+	requireBoth("tfa.okta", "token", tfa.Okta.Token, "baseUrl", tfa.Okta.BaseUrl, problems)
+	requireBoth("tfa.bitbucket", "token", tfa.Bitbucket.Token, "workspace", tfa.Bitbucket.Workspace, problems)
+}
+
+func validateDomain(domain Domain, problems *Problems) {
+	for i, host := range domain.Hosts {
+		path := fmt.Sprintf("domain.hosts[%d]", i)
+		switch {
+		case strings.TrimSpace(host) == "":
+			problems.add(path, "must not be empty")
+		case strings.Contains(host, "://") || strings.Contains(host, "/"):
+			problems.add(path, "must be a host, got %q", host)
+		}
+	}
+}
+
+func validateMining(mining Mining, problems *Problems) {
+	for i, pattern := range mining.Ignore {
+		if strings.TrimSpace(pattern) == "" {
+			problems.add(fmt.Sprintf("mining.ignore[%d]", i), "must not be empty")
+		}
+	}
+}
+
+// requireBoth reports a problem when only one of the two values is set. A value set from an env variable
+// that isn't set counts as not set
+func requireBoth(path string, name string, value string, otherName string, other string, problems *Problems) {
+	if value != "" && other == "" {
+		problems.add(path+"."+otherName, "is required when %s is set", name)
+	}
+	if value == "" && other != "" {
+		problems.add(path+"."+name, "is required when %s is set", otherName)
+	}
+}
+
+func validateUrl(path string, value string, problems *Problems) {
+	if value == "" {
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		problems.add(path, "invalid url: %s", err)
+		return
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		problems.add(path, "must be an http(s) url, got %q", value)
+	}
+}
+
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package config_test
+
+import (
+	"github.com/freddd/janitor/config"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ConfigSuite")
+}
+
+var _ = Describe("ConfigSuite", func() {
+	It("loads and validates the sample config", func() {
+		cfg, err := config.LoadConfig("config.yml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Validate(*cfg)).To(Succeed())
+		Expect(cfg.Tracker.Rules).To(HaveLen(2))
+		Expect(*cfg.Tracker.Rules[0].Entropy).To(Equal(3.5))
+		Expect(cfg.Tracker.DisabledRules).To(ConsistOf("facebook", "twitter"))
+	})
+
+	It("fails on a bad regexp", func() {
+		cfg := config.Config{Tracker: config.Tracker{Rules: []config.Rule{
+			{Name: "ok", Regexps: []string{"ok_[a-z]+"}},
+			{Name: "broken", Regexps: []string{"([a-z"}},
+		}}}
+		err := config.Validate(cfg)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix(`tracker.rules[1] (broken): invalid regexp "([a-z"`))
+	})
+
+	It("fails on an unknown severity", func() {
+		cfg := config.Config{Tracker: config.Tracker{Rules: []config.Rule{
+			{Name: "token", Regexps: []string{"tk_[a-z]+"}, Severity: "urgent"},
+		}}}
+		Expect(config.Validate(cfg)).NotTo(Succeed())
+	})
+
+	It("reports every problem with its path", func() {
+		cfg := config.Config{
+			Tracker: config.Tracker{Rules: []config.Rule{
+				{Name: "broken", Regexps: []string{"([a-z"}, Severity: "urgent"},
+			}},
+			Tfa:    config.Tfa{GitHub: config.GitHub{ApiKey: "secret", BaseUrl: "api.github.com"}},
+			Domain: config.Domain{Hosts: []string{"https://example.com"}},
+		}
+		err := config.Validate(cfg)
+		Expect(err).To(BeAssignableToTypeOf(config.Problems{}))
+
+		var paths []string
+		for _, problem := range err.(config.Problems) {
+			paths = append(paths, problem.Path)
+		}
+		Expect(paths).To(Equal([]string{
+			"tracker.rules[0] (broken)",
+			"tracker.rules[0] (broken)",
+			"tfa.github.baseUrl",
+			"tfa.github.organization",
+			"domain.hosts[0]",
+		}))
+		Expect(err.Error()).To(ContainSubstring("tfa.github.organization: is required when apiKey is set\n"))
+	})
+
+	Context("with a config on disk", func() {
+		var dir string
+		var wd string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "janitor-config")
+			Expect(err).NotTo(HaveOccurred())
+			wd, err = os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chdir(dir)).To(Succeed())
+			os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+		})
+
+		AfterEach(func() {
+			os.Chdir(wd)
+			os.Unsetenv("XDG_CONFIG_HOME")
+			os.Unsetenv("JANITOR_TEST_TOKEN")
+			os.RemoveAll(dir)
+		})
+
+		write := func(path string, content string) {
+			Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		}
+
+		It("replaces env references but leaves the regexps alone", func() {
+			os.Setenv("JANITOR_TEST_TOKEN", "xoxp-secret")
+			write("janitor.yml", `
+tfa:
+  slack:
+    token: ${JANITOR_TEST_TOKEN}
+  gitlab:
+    token: ${JANITOR_TEST_UNSET}
+tracker:
+  rules:
+    - name: suffix
+      regexps:
+        - "tk_[a-z]+$"
+`)
+			cfg, err := config.LoadConfig("janitor.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Tfa.Slack.Token).To(Equal("xoxp-secret"))
+			Expect(cfg.Tfa.Gitlab.Token).To(BeEmpty())
+			Expect(cfg.Tracker.Rules[0].Regexps).To(ConsistOf("tk_[a-z]+$"))
+		})
+
+		It("searches the working directory before XDG_CONFIG_HOME", func() {
+			cfg, err := config.LoadDefaultConfig("", "domain")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Domain.Hosts).To(BeEmpty())
+
+			write(filepath.Join(dir, "xdg", "janitor", "config.yml"), "domain:\n  hosts: [xdg.example.com]\n")
+			cfg, err = config.LoadDefaultConfig("", "domain")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Domain.Hosts).To(ConsistOf("xdg.example.com"))
+
+			write(".janitor.yml", "domain:\n  hosts: [local.example.com]\n")
+			Expect(config.FindConfig()).To(Equal(".janitor.yml"))
+			cfg, err = config.LoadDefaultConfig("", "domain")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Domain.Hosts).To(ConsistOf("local.example.com"))
+		})
+
+		It("fails on an invalid section of the command", func() {
+			write(".janitor.yml", "mining:\n  ignore: [\"\"]\n")
+			_, err := config.LoadDefaultConfig("", "mining")
+			Expect(err).To(MatchError(ContainSubstring("mining.ignore[0]: must not be empty")))
+			_, err = config.LoadDefaultConfig("", "domain")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("leaves the values that only work together to config validate", func() {
+			os.Setenv("JANITOR_TEST_TOKEN", "secret")
+			write(".janitor.yml", "tfa:\n  github:\n    apiKey: ${JANITOR_TEST_TOKEN}\n    organization: ${JANITOR_TEST_UNSET}\n")
+			cfg, err := config.LoadDefaultConfig("", "tracker")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.Tfa.GitHub.ApiKey).To(Equal("secret"))
+			_, err = config.LoadDefaultConfig("", "tfa")
+			Expect(err).NotTo(HaveOccurred())
+
+			problems, err := config.ValidateFile(".janitor.yml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(problems).To(ConsistOf(
+				config.Problem{Path: "tfa.github.organization", Message: "env variable JANITOR_TEST_UNSET isn't set", Line: 4, Warning: true},
+				config.Problem{Path: "tfa.github.organization", Message: "is required when apiKey is set", Line: 4},
+			))
+		})
+	})
+})
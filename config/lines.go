@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	yamlLine    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlKey     = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s:#'"][^:#]*?)\s*:(\s|$)`)
+	ruleName    = regexp.MustCompile(` \(.*\)$`)
+	lastSegment = regexp.MustCompile(`(\.[^.\[]+|\[\d+\])$`)
+)
+
+// LineIndex maps the yaml paths of a file (tracker.rules[1].regexps[0]) to the line they are on
+type LineIndex map[string]int
+
+type indexEntry struct {
+	indent int
+	path   string
+	item   bool
+	items  int
+}
+
+// IndexLines finds the line of every key and sequence item in block style, flow style values ([a, b]) are
+// indexed by their key only
+func IndexLines(data []byte) LineIndex {
+	index := LineIndex{}
+	var stack []*indexEntry
+	top := func() *indexEntry {
+		if len(stack) == 0 {
+			return &indexEntry{indent: -1}
+		}
+		return stack[len(stack)-1]
+	}
+
+	for number, line := range strings.Split(string(data), "\n") {
+		content := strings.TrimLeft(line, " ")
+		if content == "" || strings.HasPrefix(content, "#") || content == "---" {
+			continue
+		}
+		indent := len(line) - len(content)
+
+		for content == "-" || strings.HasPrefix(content, "- ") {
+			for len(stack) > 0 && (top().indent > indent || (top().indent == indent && top().item)) {
+				stack = stack[:len(stack)-1]
+			}
+			parent := top()
+			item := &indexEntry{indent: indent, path: fmt.Sprintf("%s[%d]", parent.path, parent.items), item: true}
+			parent.items++
+			stack = append(stack, item)
+			if _, ok := index[item.path]; !ok {
+				index[item.path] = number + 1
+			}
+
+			rest := strings.TrimLeft(content[1:], " ")
+			indent += len(content) - len(rest)
+			content = rest
+		}
+
+		match := yamlKey.FindStringSubmatch(content)
+		if match == nil {
+			continue
+		}
+		for len(stack) > 0 && top().indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		key := strings.Trim(match[1], `"'`)
+		path := key
+		if parent := top(); parent.path != "" {
+			path = parent.path + "." + key
+		}
+		stack = append(stack, &indexEntry{indent: indent, path: path})
+		if _, ok := index[path]; !ok {
+			index[path] = number + 1
+		}
+	}
+	return index
+}
+
+// Line returns the line of the path, or of the closest parent in the file, 0 if none is. The name of a rule
+// in the path of a problem, tracker.rules[1] (name), is ignored
+func (index LineIndex) Line(path string) int {
+	path = ruleName.ReplaceAllString(path, "")
+	for path != "" {
+		if line, ok := index[path]; ok {
+			return line
+		}
+		path = lastSegment.ReplaceAllString(path, "")
+	}
+	return 0
+}
+
+// ValidateFile is the strict version of LoadConfig followed by Validate, unknown fields are problems as
+// well and references to env variables that aren't set are warnings. Every problem has the line it's on,
+// problems without a path are yaml errors
+func ValidateFile(path string) (Problems, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := Problems{}
+	var cfg Config
+	err = yaml.UnmarshalStrict(data, &cfg)
+	if typeError, ok := err.(*yaml.TypeError); ok {
+		// the rest of the config is still decoded
+		for _, message := range typeError.Errors {
+			problems = append(problems, yamlProblem(message))
+		}
+	} else if err != nil {
+		return Problems{yamlProblem(err.Error())}, nil
+	}
+
+	found := Problems{}
+	interpolate(reflect.ValueOf(&cfg).Elem(), "", &found)
+	if err, ok := Validate(cfg).(Problems); ok {
+		found = append(found, err...)
+	}
+	index := IndexLines(data)
+	for _, problem := range found {
+		problem.Line = index.Line(problem.Path)
+		problems = append(problems, problem)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems, nil
+}
+
+func yamlProblem(message string) Problem {
+	match := yamlLine.FindStringSubmatch(strings.TrimSpace(message))
+	if match == nil {
+		return Problem{Message: strings.TrimPrefix(message, "yaml: ")}
+	}
+	line, _ := strconv.Atoi(match[1])
+	return Problem{Line: line, Message: match[2]}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	schemaVersion   = "http://json-schema.org/draft-07/schema#"
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+)
+
+// enums are the allowed values of a field, by type and yaml name
+var enums = map[string][]string{
+	"Rule.severity": severities,
+}
+
+// Schema is the subset of JSON Schema needed to describe the config
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// JSONSchema describes Config, it's generated from the structs so that it can't drift from what
+// LoadConfig accepts
+func JSONSchema() *Schema {
+	schema := schemaOf(reflect.TypeOf(Config{}))
+	schema.Schema = schemaVersion
+	schema.Title = "janitor config"
+	return schema
+}
+
+func schemaOf(t reflect.Type) *Schema {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return &Schema{Type: "string", Pattern: durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.Struct:
+		additional := false
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: &additional}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			property := schemaOf(field.Type)
+			property.Enum = enums[t.Name()+"."+name]
+			schema.Properties[name] = property
+		}
+		return schema
+	}
+	return &Schema{}
+}
@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	minRSABits   = 2048
+	minECDSABits = 256
+)
+
+var versions = []struct {
+	version uint16
+	name    string
+	// deprecated by RFC 8996
+	deprecated bool
+}{
+	{tls.VersionTLS10, "TLS 1.0", true},
+	{tls.VersionTLS11, "TLS 1.1", true},
+	{tls.VersionTLS12, "TLS 1.2", false},
+	{tls.VersionTLS13, "TLS 1.3", false},
+}
+
+// AuditTLS probes every protocol version and (pre TLS 1.3) cipher suite the host accepts and grades them, along
+// with the key of the leaf and OCSP stapling. Only the suites Go implements can be probed
+func (d *DomainVerifier) AuditTLS(host string) []Row {
+	target, err := ParseTarget(host)
+	if err != nil {
+		return []Row{{Status: critical, Host: host, Type: "Audit", Message: err.Error()}}
+	}
+	conn, err := d.dial(target, probe(tls.VersionTLS10, tls.VersionTLS13))
+	if err != nil {
+		return []Row{{Status: critical, Host: host, Type: "Audit", Message: err.Error()}}
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+
+	var rows []Row
+	var accepted []string
+	failed := &failedProbes{}
+	tls13 := false
+	for _, version := range versions {
+		if !d.accepts(target, probe(version.version, version.version), version.name, failed) {
+			continue
+		}
+		accepted = append(accepted, version.name)
+		tls13 = tls13 || version.version == tls.VersionTLS13
+		if version.deprecated {
+			rows = append(rows, Row{Status: warning, Host: host, Type: "Protocol", Message: fmt.Sprintf("Accepts %s", version.name)})
+		}
+	}
+	rows = append(rows, Row{Status: ok, Host: host, Type: "Protocol", Message: fmt.Sprintf("Versions: %s", strings.Join(accepted, ", "))})
+
+	rows = append(rows, d.auditCipherSuites(host, target, tls13, failed)...)
+	rows = append(rows, auditKey(host, state)...)
+	if len(failed.probes) > 0 {
+		rows = append(rows, Row{Status: warning, Host: host, Type: "Audit",
+			Message: fmt.Sprintf("Incomplete, probing %s failed: %s", strings.Join(failed.probes, ", "), failed.err)})
+	}
+
+	if len(state.OCSPResponse) == 0 {
+		rows = append(rows, Row{Status: warning, Host: host, Type: "OCSP", Message: "No OCSP response stapled"})
+	} else {
+		rows = append(rows, Row{Status: ok, Host: host, Type: "OCSP", Message: "OCSP response stapled"})
+	}
+	return rows
+}
+
+// failedProbes are the probes that neither got a handshake nor an alert, the last error is kept
+type failedProbes struct {
+	probes []string
+	err    error
+}
+
+// accepts is true if the handshake succeeds. Only an alert, or the server choosing something that wasn't
+// offered, means the probe isn't accepted, any other error is added to failed
+func (d *DomainVerifier) accepts(target Target, config *tls.Config, name string, failed *failedProbes) bool {
+	conn, err := d.dial(target, config)
+	if err == nil {
+		conn.Close()
+		return true
+	}
+	if !rejected(err) {
+		failed.probes = append(failed.probes, name)
+		failed.err = err
+	}
+	return false
+}
+
+func rejected(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return true
+	}
+	return strings.HasPrefix(err.Error(), "tls: server selected unsupported protocol version") ||
+		err.Error() == "tls: server chose an unconfigured cipher suite"
+}
+
+// auditCipherSuites offers one suite at a time, the suites of TLS 1.3 can't be configured and are all strong
+func (d *DomainVerifier) auditCipherSuites(host string, target Target, tls13 bool, failed *failedProbes) []Row {
+	var rows []Row
+	var offered []string
+	cbcOnly := true
+	for _, suite := range allSuites() {
+		if !supportsPreTLS13(suite) {
+			continue
+		}
+		config := &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{suite.ID}}
+		if !d.accepts(target, config, suite.Name, failed) {
+			continue
+		}
+		offered = append(offered, suite.Name)
+
+		switch {
+		case strings.Contains(suite.Name, "_RC4_"):
+			rows = append(rows, Row{Status: critical, Host: host, Type: "Cipher", Message: fmt.Sprintf("Offers RC4: %s", suite.Name)})
+		case strings.Contains(suite.Name, "_3DES_"):
+			rows = append(rows, Row{Status: critical, Host: host, Type: "Cipher", Message: fmt.Sprintf("Offers 3DES: %s", suite.Name)})
+		case !strings.HasPrefix(suite.Name, "TLS_ECDHE_"):
+			rows = append(rows, Row{Status: warning, Host: host, Type: "Cipher", Message: fmt.Sprintf("Offers a suite without forward secrecy: %s", suite.Name)})
+		}
+		if !strings.Contains(suite.Name, "_CBC_") {
+			cbcOnly = false
+		}
+	}
+
+	if len(offered) > 0 && cbcOnly && !tls13 {
+		rows = append(rows, Row{Status: warning, Host: host, Type: "Cipher", Message: "Only CBC suites are offered"})
+	}
+	if len(offered) > 0 {
+		rows = append(rows, Row{Status: ok, Host: host, Type: "Cipher", Message: fmt.Sprintf("Suites: %s", strings.Join(offered, ", "))})
+	}
+	return rows
+}
+
+// probe offers every suite Go implements so that servers accepting only legacy suites can be graded
+func probe(min, max uint16) *tls.Config {
+	var suites []uint16
+	for _, suite := range allSuites() {
+		suites = append(suites, suite.ID)
+	}
+	return &tls.Config{MinVersion: min, MaxVersion: max, CipherSuites: suites}
+}
+
+func allSuites() []*tls.CipherSuite {
+	return append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+}
+
+func supportsPreTLS13(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version != tls.VersionTLS13 {
+			return true
+		}
+	}
+	return false
+}
+
+func auditKey(host string, state tls.ConnectionState) []Row {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	switch key := state.PeerCertificates[0].PublicKey.(type) {
+	case *rsa.PublicKey:
+		bits := key.N.BitLen()
+		if bits < minRSABits {
+			return []Row{{Status: critical, Host: host, Type: "Key", Message: fmt.Sprintf("RSA key of %d bits, expected at least %d", bits, minRSABits)}}
+		}
+		return []Row{{Status: ok, Host: host, Type: "Key", Message: fmt.Sprintf("RSA key of %d bits", bits)}}
+	case *ecdsa.PublicKey:
+		bits := key.Curve.Params().BitSize
+		if bits < minECDSABits {
+			return []Row{{Status: critical, Host: host, Type: "Key", Message: fmt.Sprintf("ECDSA key of %d bits, expected at least %d", bits, minECDSABits)}}
+		}
+		return []Row{{Status: ok, Host: host, Type: "Key", Message: fmt.Sprintf("ECDSA key of %d bits", bits)}}
+	default:
+		return []Row{{Status: ok, Host: host, Type: "Key", Message: fmt.Sprintf("%T key", key)}}
+	}
+}
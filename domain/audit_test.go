@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+// rsaCert is a self-signed cert for localhost with a key of the given size
+func rsaCert(bits int) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// closingListener closes every connection after the first open ones
+type closingListener struct {
+	net.Listener
+	open int32
+}
+
+func (l *closingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil || atomic.AddInt32(&l.open, -1) >= 0 {
+			return conn, err
+		}
+		conn.Close()
+	}
+}
+
+var _ = Describe("Audit", func() {
+	var server *httptest.Server
+	d := &DomainVerifier{Ui: cli.NewMockUi(), Timeout: 5 * time.Second}
+
+	start := func(config *tls.Config) string {
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.TLS = config
+		// the probes fail handshakes on purpose
+		server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+		server.StartTLS()
+		return server.Listener.Addr().String()
+	}
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	rowsOf := func(rows []Row, status string) []string {
+		var messages []string
+		for _, row := range rows {
+			if row.Status == status {
+				messages = append(messages, row.Type+": "+row.Message)
+			}
+		}
+		return messages
+	}
+
+	It("passes a modern configuration", func() {
+		cert := issue("localhost", nil, time.Now().Add(24*time.Hour)).chain()
+		cert.OCSPStaple = []byte("staple")
+		host := start(&tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}})
+
+		rows := d.AuditTLS(host)
+		Expect(rowsOf(rows, critical)).To(BeEmpty())
+		Expect(rowsOf(rows, warning)).To(BeEmpty())
+		Expect(rowsOf(rows, ok)).To(ContainElement("Protocol: Versions: TLS 1.2, TLS 1.3"))
+		Expect(rowsOf(rows, ok)).To(ContainElement("Key: ECDSA key of 256 bits"))
+		Expect(rowsOf(rows, ok)).To(ContainElement("OCSP: OCSP response stapled"))
+	})
+
+	It("grades a legacy configuration", func() {
+		host := start(&tls.Config{
+			MinVersion:   tls.VersionTLS10,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+			Certificates: []tls.Certificate{rsaCert(1024)},
+		})
+
+		rows := d.AuditTLS(host)
+		Expect(rowsOf(rows, critical)).To(ConsistOf(
+			"Cipher: Offers 3DES: TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+			"Key: RSA key of 1024 bits, expected at least 2048",
+		))
+		Expect(rowsOf(rows, warning)).To(ConsistOf(
+			"Protocol: Accepts TLS 1.0",
+			"Protocol: Accepts TLS 1.1",
+			"Cipher: Offers a suite without forward secrecy: TLS_RSA_WITH_AES_128_CBC_SHA",
+			"Cipher: Only CBC suites are offered",
+			"OCSP: No OCSP response stapled",
+		))
+		Expect(rowsOf(rows, ok)).To(ContainElement("Protocol: Versions: TLS 1.0, TLS 1.1, TLS 1.2"))
+	})
+
+	It("flags RC4", func() {
+		host := start(&tls.Config{
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			Certificates: []tls.Certificate{rsaCert(2048)},
+		})
+
+		rows := d.AuditTLS(host)
+		Expect(rowsOf(rows, critical)).To(ConsistOf("Cipher: Offers RC4: TLS_ECDHE_RSA_WITH_RC4_128_SHA"))
+		Expect(rowsOf(rows, warning)).NotTo(ContainElement("Cipher: Only CBC suites are offered"))
+		Expect(rowsOf(rows, ok)).To(ContainElement("Key: RSA key of 2048 bits"))
+	})
+
+	It("reports the probes that failed without an alert", func() {
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.TLS = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{rsaCert(2048)}}
+		server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+		// the first dial and the TLS 1.0 probe get a handshake, every later connection is closed right away
+		server.Listener = &closingListener{Listener: server.Listener, open: 2}
+		server.StartTLS()
+
+		rows := d.AuditTLS(server.Listener.Addr().String())
+		Expect(rowsOf(rows, warning)).NotTo(ContainElement(HavePrefix("Protocol: Accepts")))
+		Expect(rowsOf(rows, warning)).To(ContainElement(MatchRegexp(`^Audit: Incomplete, probing TLS 1\.1, TLS 1\.2, TLS 1\.3, \S+.* failed: `)))
+	})
+
+	It("is part of the checks of a host with -audit", func() {
+		host := start(&tls.Config{Certificates: []tls.Certificate{rsaCert(2048)}})
+		types := map[string]bool{}
+		for _, row := range (&DomainVerifier{Ui: cli.NewMockUi(), Audit: true}).CheckHosts([]string{host}, 1, time.Now()) {
+			types[row.Type] = true
+		}
+		Expect(types).To(HaveKey("Protocol"))
+		Expect(types).To(HaveKey("Cipher"))
+		Expect(types).To(HaveKey("Key"))
+	})
+})
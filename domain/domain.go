@@ -2,69 +2,180 @@ package domain
 
 import (
 	"crypto/tls"
-	"fmt"
-	"time"
 	"crypto/x509"
-	"strings"
-	"github.com/mitchellh/cli"
 	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
 	"github.com/likexian/whois-go"
 	"github.com/likexian/whois-parser-go"
+	"github.com/mitchellh/cli"
 	"github.com/olekukonko/tablewriter"
+	"io"
 	"os"
+	"strings"
+	"time"
 )
 
-const whoisTimeFormat string = "2006-01-02T15:04:05.00Z"
+const (
+	whoisTimeFormat     string = "2006-01-02T15:04:05.00Z"
+	defaultPort         string = "443"
+	defaultWorkers      int    = 10
+	defaultTimeout             = 30 * time.Second
+	defaultAuditTimeout        = 5 * time.Minute
+)
 
 var sunset = map[x509.SignatureAlgorithm]string{
-	x509.MD2WithRSA: "MD2 with RSA",
-	x509.MD5WithRSA: "MD5 with RSA",
-	x509.SHA1WithRSA: "SHA1 with RSA",
-	x509.DSAWithSHA1: "DSA with SHA1",
+	x509.MD2WithRSA:    "MD2 with RSA",
+	x509.MD5WithRSA:    "MD5 with RSA",
+	x509.SHA1WithRSA:   "SHA1 with RSA",
+	x509.DSAWithSHA1:   "DSA with SHA1",
 	x509.ECDSAWithSHA1: "ECDSA with SHA1",
 }
+
 type DomainVerifier struct {
 	Ui cli.Ui
+	// Out receives the table, defaults to stdout
+	Out io.Writer
+	// Timeout of the checks of a single host, defaults to 30s
+	Timeout time.Duration
+	// RootCAs verify the certs, defaults to the system roots
+	RootCAs *x509.CertPool
+	// WarnWithin and CriticalWithin grade certs and domains expiring within them, Run defaults them to 30 days
+	// and 0, only expired is critical
+	WarnWithin     time.Duration
+	CriticalWithin time.Duration
+	// Audit adds the rows of AuditTLS to the checks of every host
+	Audit bool
+	// AuditTimeout of the audit of a single host, it's on top of Timeout. Defaults to 5m
+	AuditTimeout time.Duration
+	// Check runs every check of a host, defaults to CheckHost
+	Check func(host string, now time.Time) []Row
+	// Auditor audits a host with Audit, defaults to AuditTLS
+	Auditor func(host string) []Row
+}
+
+func (d *DomainVerifier) out() io.Writer {
+	if d.Out == nil {
+		return os.Stdout
+	}
+	return d.Out
+}
+
+func (d *DomainVerifier) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return d.Timeout
+}
+
+func (d *DomainVerifier) auditTimeout() time.Duration {
+	if d.AuditTimeout <= 0 {
+		return defaultAuditTimeout
+	}
+	return d.AuditTimeout
 }
 
 func (d *DomainVerifier) Run(args []string) int {
-	// TODO refactor
 	cmdFlags := flag.NewFlagSet("host", flag.ExitOnError)
 	cmdFlags.Usage = func() { d.Ui.Output(d.Help()) }
-	host := ""
-	cmdFlags.StringVar(&host, "host", "", "The host to check")
+	hosts := hostsFlag{}
+	hostsFile := ""
+	caBundle := ""
+	cfgPath := ""
+	workers := defaultWorkers
+	d.WarnWithin, d.CriticalWithin = defaultWarnWithin, defaultCriticalWithin
+	cmdFlags.Var(&hosts, "host", "The host to check, can be repeated")
+	cmdFlags.StringVar(&hostsFile, "hosts-file", "", "File with one host to check per line")
+	cmdFlags.IntVar(&workers, "workers", workers, "Number of hosts checked concurrently")
+	cmdFlags.DurationVar(&d.Timeout, "timeout", defaultTimeout, "How long to wait for the checks of a single host")
+	cmdFlags.Var(durationFlag{&d.WarnWithin}, "warn", "Warn about certs and domains expiring within, like 30d")
+	cmdFlags.Var(durationFlag{&d.CriticalWithin}, "critical", "Certs and domains expiring within are critical, like 7d")
+	cmdFlags.BoolVar(&d.Audit, "audit", false, "Probe the protocol versions, cipher suites, key size and OCSP stapling")
+	cmdFlags.DurationVar(&d.AuditTimeout, "audit-timeout", defaultAuditTimeout, "How long to wait for the audit of a single host")
+	cmdFlags.StringVar(&caBundle, "ca-bundle", "", "Pem file with the roots to verify against instead of the system roots")
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
 
-	if len(args) < 1 {
+	if err := cmdFlags.Parse(args); err != nil {
 		cmdFlags.Usage()
 		return 1
 	}
 
-	if err := cmdFlags.Parse(args); err != nil {
-		cmdFlags.Usage()
+	if d.CriticalWithin > d.WarnWithin {
+		d.Ui.Error(fmt.Sprintf("-critical (%s) must not be longer than -warn (%s)", formatDuration(d.CriticalWithin), formatDuration(d.WarnWithin)))
 		return 1
 	}
 
-	if host == "" {
+	if caBundle != "" {
+		roots, err := ReadCABundle(caBundle)
+		if err != nil {
+			d.Ui.Error(err.Error())
+			return 1
+		}
+		d.RootCAs = roots
+	}
+
+	if hostsFile != "" {
+		fromFile, err := ReadHosts(hostsFile)
+		if err != nil {
+			d.Ui.Error(err.Error())
+			return 1
+		}
+		hosts = append(hosts, fromFile...)
+	}
+
+	if len(hosts) == 0 {
+		cfg, err := config.LoadDefaultConfig(cfgPath, "domain")
+		if err != nil {
+			d.Ui.Error(err.Error())
+			return 1
+		}
+		hosts = cfg.Domain.Hosts
+	}
+	if len(hosts) == 0 {
 		cmdFlags.Usage()
 		return 1
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Status", "Type", "Message"})
+	d.Ui.Info(fmt.Sprintf("---------- Validating Certificate and Domain of %d hosts: ----------", len(hosts)))
+	rows := d.CheckHosts(unique(hosts), workers, time.Now())
+
+	table := tablewriter.NewWriter(d.out())
+	table.SetHeader([]string{"Status", "Host", "Type", "Message"})
 	table.SetRowLine(true)
-	d.Ui.Info("---------- Validating Certificate and Domain: ----------")
-	d.ValidateCert(host, time.Now(), table)
-	d.ValidateDomain(host, time.Now(), table)
+	for _, row := range rows {
+		table.Append([]string{row.Status, row.Host, row.Type, row.Message})
+	}
 	table.Render()
 	return 0
 }
 
 func (d *DomainVerifier) Help() string {
 	helpText := `
-		Usage: janitor domain --host
+		Usage: janitor domain --host <host>
 		  Checks the host SSL domain expiry and if it's using an algo that is unsafe
 		Options:
-		  -host  the host to check (mandatory)
+		  -host       the host to check, can be repeated: host[:port] [starttls=<protocol>] [sni=<name>]
+		              the port defaults to 443 or the port of the starttls protocol, one of smtp, imap, pop3,
+		              ftp, ldap or postgres, and sni, the name the cert has to be valid for, to the host
+		  -hosts-file file with one host to check per line, blank lines and lines starting with # are skipped
+		  -workers    number of hosts checked concurrently (defaults to 10)
+		  -timeout    how long to wait for the checks of a single host (defaults to 30s)
+		  -warn       certs and domains expiring within are a warning, days like 30d or a duration like 12h
+		              (defaults to 30d)
+		  -critical   certs and domains expiring within are critical (defaults to 0, only expired ones)
+		  -ca-bundle  pem file with the roots the chains are verified against (defaults to the system roots)
+		  -audit      also probe every protocol version and cipher suite the host accepts: TLS 1.0 and 1.1,
+		              RC4, 3DES, CBC only and suites without forward secrecy, RSA keys under 2048 bits,
+		              ECDSA keys under 256 bits and a missing OCSP staple are reported. Only the suites Go
+		              implements are probed, DHE, EXPORT, NULL and single DES suites aren't detected
+		  -audit-timeout
+		              how long to wait for the audit of a single host (defaults to 5m), it runs after the
+		              other checks so their rows are kept when it times out
+		  -cfg        the global config file, defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml,
+		              domain.hosts are checked when neither -host nor -hosts-file is given
+		Every problem with a chain is a row: hostname mismatch, expired or expiring leaf, intermediate or root, an
+		intermediate expiring before the leaf, unknown authority or incomplete chain, with the subject, issuer and
+		serial of the cert. All hosts end up in one table, the most severe problems first
 		`
 
 	return strings.TrimSpace(helpText)
@@ -74,73 +185,75 @@ func (d *DomainVerifier) Synopsis() string {
 	return "Checks the host SSL domain expiry and if it's using an algo that is unsafe"
 }
 
-func (d DomainVerifier) ValidateCert(host string, whenToWarn time.Time, table *tablewriter.Table) {
-	d.Ui.Info(fmt.Sprintf("Checking expiry of domain for host=%s", host))
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%s", host, "443"), nil)
+// CheckHost validates the certificate and the domain of the host, CheckHosts adds the audit
+func (d *DomainVerifier) CheckHost(host string, now time.Time) []Row {
+	return append(d.ValidateCert(host, now), d.ValidateDomain(host, now)...)
+}
+
+func (d *DomainVerifier) ValidateCert(host string, whenToWarn time.Time) []Row {
+	target, err := ParseTarget(host)
 	if err != nil {
-		d.Ui.Error(err.Error())
-		return
+		return []Row{{Status: critical, Host: host, Type: "Certificate", Message: err.Error()}}
+	}
+	name := target.ServerName
+	conn, err := d.dial(target, &tls.Config{})
+	if err != nil {
+		return []Row{{Status: critical, Host: host, Type: "Certificate", Message: err.Error()}}
 	}
 	defer conn.Close()
 
-	for _, chain := range conn.ConnectionState().VerifiedChains {
-		for i, cert := range chain {
-			if i != len(chain)-1 {
-				algorithm := sunset[cert.SignatureAlgorithm]
-				if algorithm != "" {
-					table.Append([]string{"CRITICAL", "Certificate", fmt.Sprintf("Cert is using a unsafe algo: %s, dns names: %+v", algorithm, cert.DNSNames)})
-				}
-			}
-			if contains(cert.DNSNames, host) {
-				if whenToWarn.After(cert.NotAfter) {
-					table.Append([]string{"CRITICAL", "Certificate", fmt.Sprintf("Cert already expired --- Host: %+v, Expiry: %+v", cert.DNSNames, cert.NotAfter)})
-				}
-				if int(cert.NotAfter.Sub(whenToWarn) / (24 * time.Hour)) < 30 {
-					table.Append([]string{"WARNING", "Certificate", fmt.Sprintf("Cert expiring within 30 days --- Host: %+v, Expiry: %+v", cert.DNSNames, cert.NotAfter)})
-				} else {
-					table.Append([]string{"OK", "Certificate", fmt.Sprintf("Host: %+v, Expiry: %+v", cert.DNSNames, cert.NotAfter)})
-				}
+	chain, rows := d.verify(host, name, conn.ConnectionState().PeerCertificates, whenToWarn)
+	for i, cert := range chain {
+		if i != len(chain)-1 {
+			algorithm := sunset[cert.SignatureAlgorithm]
+			if algorithm != "" {
+				rows = append(rows, Row{Status: critical, Host: host, Type: "Certificate", Message: fmt.Sprintf("Cert is using a unsafe algo: %s, dns names: %+v", algorithm, cert.DNSNames)})
 			}
 		}
 	}
+	if len(chain) > 0 {
+		rows = append(rows, d.gradeChain(host, chain, whenToWarn)...)
+	}
+	return rows
 }
 
-func (d DomainVerifier) ValidateDomain(host string, whenToWarn time.Time, table *tablewriter.Table) {
-	whoisResult, err := whois.Whois(host)
+func (d *DomainVerifier) ValidateDomain(host string, whenToWarn time.Time) []Row {
+	target, err := ParseTarget(host)
+	if err != nil {
+		return []Row{{Status: critical, Host: host, Type: "Domain", Message: err.Error()}}
+	}
+	name := target.ServerName
+	whoisResult, err := whois.Whois(name)
 	if err != nil {
-		d.Ui.Error(err.Error())
+		return []Row{{Status: warning, Host: host, Type: "Domain", Message: fmt.Sprintf("Whois failed: %s", err)}}
 	}
 	parsed, err := whois_parser.Parser(whoisResult)
 	if err != nil {
-		d.Ui.Error(err.Error())
+		return []Row{{Status: warning, Host: host, Type: "Domain", Message: fmt.Sprintf("Unable to parse whois: %s", err)}}
 	}
-	// Print the domain status
+
+	var rows []Row
+	// The domain status
 	if strings.HasPrefix(parsed.Registrar.DomainStatus, "ok") {
-		table.Append([]string{"OK", "Domain", fmt.Sprintf("Domain status: %s", parsed.Registrar.DomainStatus)})
+		rows = append(rows, Row{Status: ok, Host: host, Type: "Domain", Message: fmt.Sprintf("Domain status: %s", parsed.Registrar.DomainStatus)})
 	} else {
-		table.Append([]string{"WARNING", "Domain", fmt.Sprintf("Domain status: %s", parsed.Registrar.DomainStatus)})
+		rows = append(rows, Row{Status: warning, Host: host, Type: "Domain", Message: fmt.Sprintf("Domain status: %s", parsed.Registrar.DomainStatus)})
 	}
 
-	// Print the domain expiration date
+	// The domain expiration date
 	expirationDate, err := time.Parse(whoisTimeFormat, parsed.Registrar.ExpirationDate)
 	if err != nil {
-		d.Ui.Error(err.Error())
+		return append(rows, Row{Status: warning, Host: host, Type: "Domain", Message: fmt.Sprintf("Unable to parse the expiration date: %s", err)})
 	}
 
-	if whenToWarn.After(expirationDate) {
-		table.Append([]string{"CRITICAL", "Domain", fmt.Sprintf("Domain (%s) has already expired: %s", host, expirationDate)})
-	} else if int(expirationDate.Sub(whenToWarn) / (24 * time.Hour)) < 30 {
-		table.Append([]string{"WARNING", "Domain", fmt.Sprintf("Domain (%s) is expiring within 30 days: %s", host, expirationDate)})
-	} else {
-		table.Append([]string{"OK", "Domain", fmt.Sprintf("Domain (%s) is expiring at: %s", host, expirationDate)})
+	status, within := d.grade(expirationDate, whenToWarn)
+	switch {
+	case !expirationDate.After(whenToWarn):
+		rows = append(rows, Row{Status: critical, Host: host, Type: "Domain", Message: fmt.Sprintf("Domain (%s) has already expired: %s", name, expirationDate)})
+	case status != ok:
+		rows = append(rows, Row{Status: status, Host: host, Type: "Domain", Message: fmt.Sprintf("Domain (%s) is expiring within %s: %s", name, formatDuration(within), expirationDate)})
+	default:
+		rows = append(rows, Row{Status: ok, Host: host, Type: "Domain", Message: fmt.Sprintf("Domain (%s) is expiring at: %s", name, expirationDate)})
 	}
+	return rows
 }
-
-func contains(s []string, e string) bool {
-	for _, a := range s {
-		if a == e {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
@@ -1,8 +1,15 @@
 package domain
 
 import (
+	"bytes"
+	"github.com/mitchellh/cli"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -12,8 +19,119 @@ func TestCert(t *testing.T) {
 	RunSpecs(t, "CertSuite")
 }
 
-var _ = Describe("CertSuite", func() {
-	It("", func() {
-		cv := DomainVerifier{}
+var _ = Describe("Hosts", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-domain")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reads a host per line", func() {
+		path := filepath.Join(dir, "hosts")
+		Expect(ioutil.WriteFile(path, []byte("# ours\nexample.com\n\n  example.org:8443  \n"), 0600)).To(Succeed())
+		Expect(ReadHosts(path)).To(Equal([]string{"example.com", "example.org:8443"}))
+	})
+
+	It("checks a bounded number of hosts at a time", func() {
+		var running, max int32
+		d := &DomainVerifier{Ui: cli.NewMockUi(), Check: func(host string, now time.Time) []Row {
+			current := atomic.AddInt32(&running, 1)
+			for {
+				seen := atomic.LoadInt32(&max)
+				if current <= seen || atomic.CompareAndSwapInt32(&max, seen, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return []Row{{Status: ok, Host: host, Type: "Certificate"}}
+		}}
+
+		var hosts []string
+		for i := 0; i < 12; i++ {
+			hosts = append(hosts, string(rune('a'+i))+".example.com")
+		}
+		start := time.Now()
+		rows := d.CheckHosts(hosts, 3, time.Now())
+		Expect(rows).To(HaveLen(12))
+		Expect(atomic.LoadInt32(&max)).To(Equal(int32(3)))
+		Expect(time.Since(start)).To(BeNumerically("<", 12*20*time.Millisecond))
+	})
+
+	It("gives up on a host after the timeout", func() {
+		d := &DomainVerifier{Ui: cli.NewMockUi(), Timeout: 20 * time.Millisecond, Check: func(host string, now time.Time) []Row {
+			if host == "slow.example.com" {
+				time.Sleep(time.Second)
+			}
+			return []Row{{Status: ok, Host: host, Type: "Certificate"}}
+		}}
+
+		rows := d.CheckHosts([]string{"slow.example.com", "fast.example.com"}, 2, time.Now())
+		Expect(rows).To(Equal([]Row{
+			{Status: critical, Host: "slow.example.com", Type: "Timeout", Message: "No result within 20ms"},
+			{Status: ok, Host: "fast.example.com", Type: "Certificate"},
+		}))
+	})
+
+	It("keeps the rows of the checks when the audit times out", func() {
+		d := &DomainVerifier{Ui: cli.NewMockUi(), Audit: true, AuditTimeout: 20 * time.Millisecond,
+			Check: func(host string, now time.Time) []Row {
+				return []Row{{Status: ok, Host: host, Type: "Certificate"}}
+			},
+			Auditor: func(host string) []Row {
+				if host == "slow.example.com" {
+					time.Sleep(time.Second)
+				}
+				return []Row{{Status: ok, Host: host, Type: "Protocol"}}
+			}}
+
+		rows := d.CheckHosts([]string{"slow.example.com", "fast.example.com"}, 2, time.Now())
+		Expect(rows).To(Equal([]Row{
+			{Status: warning, Host: "slow.example.com", Type: "Audit", Message: "No result within 20ms"},
+			{Status: ok, Host: "fast.example.com", Type: "Certificate"},
+			{Status: ok, Host: "fast.example.com", Type: "Protocol"},
+			{Status: ok, Host: "slow.example.com", Type: "Certificate"},
+		}))
+	})
+
+	It("renders one table of every host, the most severe first", func() {
+		path := filepath.Join(dir, "hosts")
+		Expect(ioutil.WriteFile(path, []byte("expiring.example.com\nok.example.com\n"), 0600)).To(Succeed())
+
+		statuses := map[string]string{
+			"ok.example.com":       ok,
+			"expiring.example.com": warning,
+			"expired.example.com":  critical,
+		}
+		out := &bytes.Buffer{}
+		d := &DomainVerifier{Ui: cli.NewMockUi(), Out: out, Check: func(host string, now time.Time) []Row {
+			return []Row{
+				{Status: ok, Host: host, Type: "Domain"},
+				{Status: statuses[host], Host: host, Type: "Certificate"},
+			}
+		}}
+		Expect(d.Run([]string{"-host", "ok.example.com", "-host", "expired.example.com", "-hosts-file", path})).To(Equal(0))
+
+		var order []string
+		for _, line := range strings.Split(out.String(), "\n") {
+			fields := strings.Fields(strings.Replace(line, "|", " ", -1))
+			if len(fields) >= 3 && strings.HasSuffix(fields[1], ".example.com") {
+				order = append(order, fields[0]+" "+fields[1]+" "+fields[2])
+			}
+		}
+		Expect(order).To(Equal([]string{
+			"CRITICAL expired.example.com Certificate",
+			"WARNING expiring.example.com Certificate",
+			"OK expired.example.com Domain",
+			"OK expiring.example.com Domain",
+			"OK ok.example.com Domain",
+			"OK ok.example.com Certificate",
+		}))
 	})
-})
\ No newline at end of file
+})
@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day                   = 24 * time.Hour
+	defaultWarnWithin     = 30 * day
+	defaultCriticalWithin = 0
+	durationFormat        = "a number of days like 30d or a duration like 12h"
+)
+
+// durationFlag is a -warn or -critical threshold, see parseDuration
+type durationFlag struct {
+	value *time.Duration
+}
+
+func (f durationFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return formatDuration(*f.value)
+}
+
+func (f durationFlag) Set(value string) error {
+	duration, err := parseDuration(value)
+	if err != nil {
+		return err
+	}
+	*f.value = duration
+	return nil
+}
+
+// parseDuration accepts days, 30d, on top of what time.ParseDuration does
+func parseDuration(value string) (time.Duration, error) {
+	var duration time.Duration
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q, expected %s", value, durationFormat)
+		}
+		duration = time.Duration(days) * day
+	} else {
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q, expected %s", value, durationFormat)
+		}
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q, must not be negative", value)
+	}
+	return duration, nil
+}
+
+func formatDuration(duration time.Duration) string {
+	if duration%day == 0 {
+		return fmt.Sprintf("%dd", duration/day)
+	}
+	return duration.String()
+}
+
+// grade is the status of something expiring at expiry, critical within CriticalWithin, warning within
+// WarnWithin. The threshold that was crossed is returned along with it
+func (d *DomainVerifier) grade(expiry time.Time, now time.Time) (string, time.Duration) {
+	remaining := expiry.Sub(now)
+	switch {
+	case remaining <= 0:
+		return critical, 0
+	case remaining < d.CriticalWithin:
+		return critical, d.CriticalWithin
+	case remaining < d.WarnWithin:
+		return warning, d.WarnWithin
+	default:
+		return ok, 0
+	}
+}
+
+// gradeChain grades the expiry of every cert in the chain, the leaf gets a row even if it's fine. Expired
+// certs are left out, verify reports them
+func (d *DomainVerifier) gradeChain(host string, chain []*x509.Certificate, now time.Time) []Row {
+	var rows []Row
+	leaf := chain[0]
+	for i, cert := range chain {
+		if now.After(cert.NotAfter) {
+			continue
+		}
+		position := certPosition(i, cert)
+		status, within := d.grade(cert.NotAfter, now)
+		switch {
+		case status != ok:
+			rows = append(rows, Row{Status: status, Host: host, Type: "Certificate",
+				Message: fmt.Sprintf("%s expiring within %s at %s, %s", position, formatDuration(within), cert.NotAfter, describe(cert))})
+		case i == 0:
+			rows = append(rows, Row{Status: ok, Host: host, Type: "Certificate", Message: fmt.Sprintf("Host: %+v, Expiry: %+v", names(leaf), leaf.NotAfter)})
+		case cert.NotAfter.Before(leaf.NotAfter):
+			// the leaf is only as good as the chain, it has to be replaced before the leaf expires
+			rows = append(rows, Row{Status: warning, Host: host, Type: "Certificate",
+				Message: fmt.Sprintf("%s expires before the leaf at %s, %s", position, cert.NotAfter, describe(cert))})
+		}
+	}
+	return rows
+}
+
+// names are the dns names and ip addresses the cert is valid for
+func names(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"bytes"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Expiry", func() {
+	It("parses days and durations", func() {
+		Expect(parseDuration("30d")).To(Equal(30 * day))
+		Expect(parseDuration("0d")).To(Equal(time.Duration(0)))
+		Expect(parseDuration("36h")).To(Equal(36 * time.Hour))
+
+		_, err := parseDuration("thirty days")
+		Expect(err).To(MatchError(`invalid duration "thirty days", expected a number of days like 30d or a duration like 12h`))
+		_, err = parseDuration("-1d")
+		Expect(err).To(MatchError(`invalid duration "-1d", must not be negative`))
+
+		Expect(formatDuration(7 * day)).To(Equal("7d"))
+		Expect(formatDuration(36 * time.Hour)).To(Equal("36h0m0s"))
+	})
+
+	It("grades by the most severe threshold crossed", func() {
+		now := time.Now()
+		d := &DomainVerifier{WarnWithin: 30 * day, CriticalWithin: 7 * day}
+		grade := func(expiry time.Time) []interface{} {
+			status, within := d.grade(expiry, now)
+			return []interface{}{status, within}
+		}
+		Expect(grade(now.Add(-time.Hour))).To(Equal([]interface{}{critical, time.Duration(0)}))
+		Expect(grade(now.Add(6 * day))).To(Equal([]interface{}{critical, 7 * day}))
+		Expect(grade(now.Add(29 * day))).To(Equal([]interface{}{warning, 30 * day}))
+		Expect(grade(now.Add(31 * day))).To(Equal([]interface{}{ok, time.Duration(0)}))
+	})
+
+	It("rejects a critical threshold longer than the warning one", func() {
+		ui := cli.NewMockUi()
+		d := &DomainVerifier{Ui: ui, Out: &bytes.Buffer{}}
+		Expect(d.Run([]string{"-host", "example.com", "-warn", "7d", "-critical", "30d"})).To(Equal(1))
+		Expect(ui.ErrorWriter.String()).To(ContainSubstring("-critical (30d) must not be longer than -warn (7d)"))
+	})
+})
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	critical = "CRITICAL"
+	warning  = "WARNING"
+	ok       = "OK"
+)
+
+var severity = map[string]int{critical: 0, warning: 1, ok: 2}
+
+// Row is a line in the combined table of all hosts
+type Row struct {
+	Status  string
+	Host    string
+	Type    string
+	Message string
+}
+
+// hostsFlag collects every -host
+type hostsFlag []string
+
+func (hosts *hostsFlag) String() string {
+	return strings.Join(*hosts, ",")
+}
+
+func (hosts *hostsFlag) Set(host string) error {
+	*hosts = append(*hosts, host)
+	return nil
+}
+
+// ReadHosts returns the host[:port] on every line of the file, blank lines and comments (#) are skipped
+func ReadHosts(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	return hosts, scanner.Err()
+}
+
+func unique(hosts []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, host := range hosts {
+		if !seen[host] {
+			seen[host] = true
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// CheckHosts checks at most workers hosts at a time and returns the rows of all of them, the most severe
+// first. A host that isn't done within the timeout gets a CRITICAL row, its checks are left to finish
+// in the background. With Audit the host is audited after the checks, an audit that isn't done within
+// the audit timeout gets a WARNING row and the rows of the checks are kept
+func (d *DomainVerifier) CheckHosts(hosts []string, workers int, now time.Time) []Row {
+	check := d.Check
+	if check == nil {
+		check = d.CheckHost
+	}
+	audit := d.Auditor
+	if audit == nil {
+		audit = d.AuditTLS
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([][]Row, len(hosts))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				host := hosts[i]
+				results[i] = d.withTimeout(d.timeout(), Row{Status: critical, Host: host, Type: "Timeout"}, func() []Row {
+					return check(host, now)
+				})
+				if d.Audit {
+					// the audit takes a handshake per version and suite, it gets its own timeout so that the
+					// rows of the other checks are kept
+					results[i] = append(results[i], d.withTimeout(d.auditTimeout(), Row{Status: warning, Host: host, Type: "Audit"}, func() []Row {
+						return audit(host)
+					})...)
+				}
+			}
+		}()
+	}
+	for i := range hosts {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var rows []Row
+	for _, result := range results {
+		rows = append(rows, result...)
+	}
+	sortRows(rows)
+	return rows
+}
+
+// withTimeout returns the rows of run, or only timedOut if they aren't there within timeout
+func (d *DomainVerifier) withTimeout(timeout time.Duration, timedOut Row, run func() []Row) []Row {
+	done := make(chan []Row, 1)
+	go func() {
+		done <- run()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case rows := <-done:
+		return rows
+	case <-timer.C:
+		timedOut.Message = fmt.Sprintf("No result within %s", timeout)
+		return []Row{timedOut}
+	}
+}
+
+// sortRows puts the most severe rows first, hosts are kept together and their rows in the order of the checks
+func sortRows(rows []Row) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if severity[rows[i].Status] != severity[rows[j].Status] {
+			return severity[rows[i].Status] < severity[rows[j].Status]
+		}
+		return rows[i].Host < rows[j].Host
+	})
+}
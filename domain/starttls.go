@@ -0,0 +1,322 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ldapStartTLSRequest is the ExtendedRequest for 1.3.6.1.4.1.1466.20037 with message id 1
+var ldapStartTLSRequest = append([]byte{0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16}, "1.3.6.1.4.1.1466.20037"...)
+
+// postgresSSLRequest is the length (8) followed by the SSLRequest code 80877103
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+type protocol struct {
+	port string
+	// negotiate upgrades the plain connection, the tls handshake follows
+	negotiate func(conn net.Conn) error
+}
+
+var protocols = map[string]protocol{
+	"smtp":     {port: "25", negotiate: smtpStartTLS},
+	"imap":     {port: "143", negotiate: imapStartTLS},
+	"pop3":     {port: "110", negotiate: pop3StartTLS},
+	"ftp":      {port: "21", negotiate: ftpStartTLS},
+	"ldap":     {port: "389", negotiate: ldapStartTLS},
+	"postgres": {port: "5432", negotiate: postgresStartTLS},
+}
+
+// Target is what a host given to the command is parsed into: host[:port] [starttls=<protocol>] [sni=<name>]
+type Target struct {
+	// Addr is dialed, the port defaults to the one of the starttls protocol or 443
+	Addr string
+	// ServerName is sent as SNI and is the name the cert has to be valid for, defaults to the host
+	ServerName string
+	// StartTLS is the protocol negotiated before the handshake, empty for tls from the start
+	StartTLS string
+}
+
+func ParseTarget(s string) (Target, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return Target{}, errors.New("empty host")
+	}
+
+	target := Target{}
+	for _, option := range fields[1:] {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return Target{}, fmt.Errorf("%s: expected starttls=<protocol> or sni=<name>, got %q", s, option)
+		}
+		switch parts[0] {
+		case "starttls":
+			if _, ok := protocols[parts[1]]; !ok {
+				return Target{}, fmt.Errorf("%s: unknown starttls protocol %q, expected one of %s", s, parts[1], strings.Join(protocolNames(), ", "))
+			}
+			target.StartTLS = parts[1]
+		case "sni":
+			target.ServerName = parts[1]
+		default:
+			return Target{}, fmt.Errorf("%s: unknown option %q", s, parts[0])
+		}
+	}
+
+	port := defaultPort
+	if target.StartTLS != "" {
+		port = protocols[target.StartTLS].port
+	}
+	host, explicitPort, err := net.SplitHostPort(fields[0])
+	if err != nil {
+		host = strings.Trim(fields[0], "[]")
+	} else {
+		port = explicitPort
+	}
+
+	target.Addr = net.JoinHostPort(host, port)
+	if target.ServerName == "" {
+		target.ServerName = host
+	}
+	return target, nil
+}
+
+func protocolNames() []string {
+	var names []string
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dial connects to the target and completes the tls handshake with the config, negotiating starttls first
+// if needed. The certs aren't verified, the problems are reported by verify instead
+func (d *DomainVerifier) dial(target Target, config *tls.Config) (*tls.Conn, error) {
+	conn, err := net.DialTimeout("tcp", target.Addr, d.timeout())
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(d.timeout()))
+
+	if target.StartTLS != "" {
+		if err := protocols[target.StartTLS].negotiate(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s starttls: %s", target.StartTLS, err)
+		}
+	}
+
+	config = config.Clone()
+	config.ServerName = target.ServerName
+	config.InsecureSkipVerify = true
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// readReply reads a (multiline, 250-...) reply of an smtp or ftp server and checks the code
+func readReply(reader *bufio.Reader, code string) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, code) {
+			return fmt.Errorf("unexpected reply: %s", line)
+		}
+		if len(line) == len(code) || line[len(code)] == ' ' {
+			return nil
+		}
+	}
+}
+
+func smtpStartTLS(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := readReply(reader, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "EHLO janitor\r\n"); err != nil {
+		return err
+	}
+	if err := readReply(reader, "250"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(reader, "220")
+}
+
+func ftpStartTLS(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := readReply(reader, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "AUTH TLS\r\n"); err != nil {
+		return err
+	}
+	return readReply(reader, "234")
+}
+
+func imapStartTLS(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	greeting, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(greeting))
+	}
+	if _, err := io.WriteString(conn, "a1 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		// untagged responses (* CAPABILITY ...) can come first
+		if strings.HasPrefix(line, "a1 ") {
+			if !strings.HasPrefix(line, "a1 OK") {
+				return fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+			}
+			return nil
+		}
+	}
+}
+
+func pop3StartTLS(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := readPop3Reply(reader); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+		return err
+	}
+	return readPop3Reply(reader)
+}
+
+func readPop3Reply(reader *bufio.Reader) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// ldapStartTLS sends the StartTLS extended operation (RFC 4511 4.14) and checks the
+// resultCode of the ExtendedResponse
+func ldapStartTLS(conn net.Conn) error {
+	if _, err := conn.Write(ldapStartTLSRequest); err != nil {
+		return err
+	}
+
+	message, err := readBER(conn, 0x30)
+	if err != nil {
+		return err
+	}
+	// messageID INTEGER, then the ExtendedResponse [APPLICATION 24] starting with the resultCode ENUMERATED
+	if len(message) < 3 || message[0] != 0x02 || len(message) < 2+int(message[1]) {
+		return errors.New("malformed response")
+	}
+	response := message[2+int(message[1]):]
+	if len(response) < 2 || response[0] != 0x78 {
+		return errors.New("not an extended response")
+	}
+	body, err := berContent(response[1:])
+	if err != nil {
+		return err
+	}
+	if len(body) < 3 || body[0] != 0x0a || body[1] != 0x01 {
+		return errors.New("malformed result code")
+	}
+	if body[2] != 0 {
+		return fmt.Errorf("result code %d", body[2])
+	}
+	return nil
+}
+
+// readBER reads an element with the tag from the connection and returns its content
+func readBER(conn net.Conn, tag byte) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != tag {
+		return nil, fmt.Errorf("unexpected tag 0x%02x", header[0])
+	}
+
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		size := int(header[1] & 0x7f)
+		if size == 0 || size > 4 {
+			return nil, errors.New("unsupported length")
+		}
+		bytes := make([]byte, size)
+		if _, err := io.ReadFull(conn, bytes); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range bytes {
+			length = length<<8 | int(b)
+		}
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(conn, content)
+	return content, err
+}
+
+// berContent parses the length at the start of data and returns the content that follows
+func berContent(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("missing length")
+	}
+	if data[0]&0x80 == 0 {
+		length := int(data[0])
+		if len(data) < 1+length {
+			return nil, errors.New("truncated")
+		}
+		return data[1 : 1+length], nil
+	}
+
+	size := int(data[0] & 0x7f)
+	if size == 0 || size > 4 || len(data) < 1+size {
+		return nil, errors.New("unsupported length")
+	}
+	length := 0
+	for _, b := range data[1 : 1+size] {
+		length = length<<8 | int(b)
+	}
+	if len(data) < 1+size+length {
+		return nil, errors.New("truncated")
+	}
+	return data[1+size : 1+size+length], nil
+}
+
+func postgresStartTLS(conn net.Conn) error {
+	if _, err := conn.Write(postgresSSLRequest); err != nil {
+		return err
+	}
+	answer := make([]byte, 1)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return err
+	}
+	if answer[0] != 'S' {
+		return fmt.Errorf("server refused ssl (%q)", answer[0])
+	}
+	return nil
+}
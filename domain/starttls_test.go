@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/tls"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// serve accepts a single connection, runs the plain text part of the protocol and then the tls handshake
+func serve(cert tls.Certificate, negotiate func(conn net.Conn, reader *bufio.Reader)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() {
+		defer GinkgoRecover()
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if negotiate != nil {
+			negotiate(conn, bufio.NewReader(conn))
+		}
+		tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+	}()
+	return listener.Addr().String()
+}
+
+func expectLine(reader *bufio.Reader, expected string) {
+	line, err := reader.ReadString('\n')
+	Expect(err).NotTo(HaveOccurred())
+	Expect(strings.TrimRight(line, "\r\n")).To(Equal(expected))
+}
+
+var _ = Describe("Targets", func() {
+	It("parses the port, sni and starttls protocol", func() {
+		Expect(ParseTarget("example.com")).To(Equal(Target{Addr: "example.com:443", ServerName: "example.com"}))
+		Expect(ParseTarget("[::1]:8443")).To(Equal(Target{Addr: "[::1]:8443", ServerName: "::1"}))
+		Expect(ParseTarget("mail.example.com starttls=smtp")).To(Equal(Target{Addr: "mail.example.com:25", ServerName: "mail.example.com", StartTLS: "smtp"}))
+		Expect(ParseTarget("10.0.0.1:5433  starttls=postgres sni=db.example.com")).To(Equal(Target{Addr: "10.0.0.1:5433", ServerName: "db.example.com", StartTLS: "postgres"}))
+
+		_, err := ParseTarget("example.com starttls=xmpp")
+		Expect(err).To(MatchError(ContainSubstring(`unknown starttls protocol "xmpp", expected one of ftp, imap, ldap, pop3, postgres, smtp`)))
+		_, err = ParseTarget("example.com sni")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("STARTTLS", func() {
+	var cert tls.Certificate
+	var d *DomainVerifier
+
+	BeforeEach(func() {
+		localhost := issue("localhost", nil, time.Now().Add(365*24*time.Hour))
+		cert = localhost.chain()
+		d = &DomainVerifier{Ui: cli.NewMockUi(), Timeout: 5 * time.Second, RootCAs: localhost.pool()}
+	})
+
+	validate := func(host string) []Row {
+		return d.ValidateCert(host, time.Now())
+	}
+
+	expectValid := func(rows []Row) {
+		Expect(rows).To(HaveLen(1))
+		Expect(rows[0].Status).To(Equal(ok))
+		Expect(rows[0].Message).To(ContainSubstring("[localhost]"))
+	}
+
+	It("uses the sni instead of the dialed address", func() {
+		addr := serve(cert, nil)
+		expectValid(validate(addr + " sni=localhost"))
+
+		addr = serve(cert, nil)
+		rows := validate(addr + " sni=example.com")
+		Expect(rows[0].Status).To(Equal(critical))
+		Expect(rows[0].Message).To(ContainSubstring("example.com"))
+	})
+
+	It("negotiates smtp", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			io.WriteString(conn, "220-mail.example.com ESMTP\r\n220 ready\r\n")
+			expectLine(reader, "EHLO janitor")
+			io.WriteString(conn, "250-mail.example.com\r\n250-STARTTLS\r\n250 SIZE 1000\r\n")
+			expectLine(reader, "STARTTLS")
+			io.WriteString(conn, "220 go ahead\r\n")
+		})
+		expectValid(validate(addr + " starttls=smtp sni=localhost"))
+	})
+
+	It("negotiates imap", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			io.WriteString(conn, "* OK IMAP4rev1 ready\r\n")
+			expectLine(reader, "a1 STARTTLS")
+			io.WriteString(conn, "* CAPABILITY IMAP4rev1\r\na1 OK begin tls\r\n")
+		})
+		expectValid(validate(addr + " starttls=imap sni=localhost"))
+	})
+
+	It("negotiates pop3", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			io.WriteString(conn, "+OK POP3 ready\r\n")
+			expectLine(reader, "STLS")
+			io.WriteString(conn, "+OK begin tls\r\n")
+		})
+		expectValid(validate(addr + " starttls=pop3 sni=localhost"))
+	})
+
+	It("negotiates ftp", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			io.WriteString(conn, "220 FTP ready\r\n")
+			expectLine(reader, "AUTH TLS")
+			io.WriteString(conn, "234 AUTH TLS ok\r\n")
+		})
+		expectValid(validate(addr + " starttls=ftp sni=localhost"))
+	})
+
+	It("negotiates ldap", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			request := make([]byte, len(ldapStartTLSRequest))
+			_, err := io.ReadFull(reader, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(request).To(Equal(ldapStartTLSRequest))
+			// ExtendedResponse with resultCode success, empty matchedDN and diagnosticMessage and the oid
+			response := append([]byte{0x78, 0x1f, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00, 0x8a, 0x16}, "1.3.6.1.4.1.1466.20037"...)
+			conn.Write(append([]byte{0x30, byte(3 + len(response)), 0x02, 0x01, 0x01}, response...))
+		})
+		expectValid(validate(addr + " starttls=ldap sni=localhost"))
+	})
+
+	It("negotiates postgres", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			request := make([]byte, len(postgresSSLRequest))
+			_, err := io.ReadFull(reader, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(request).To(Equal(postgresSSLRequest))
+			conn.Write([]byte{'S'})
+		})
+		expectValid(validate(addr + " starttls=postgres sni=localhost"))
+	})
+
+	It("reports a server refusing starttls", func() {
+		addr := serve(cert, func(conn net.Conn, reader *bufio.Reader) {
+			io.ReadFull(reader, make([]byte, len(postgresSSLRequest)))
+			conn.Write([]byte{'N'})
+		})
+		rows := validate(addr + " starttls=postgres sni=localhost")
+		Expect(rows).To(Equal([]Row{{Status: critical, Host: addr + " starttls=postgres sni=localhost", Type: "Certificate",
+			Message: `postgres starttls: server refused ssl ('N')`}}))
+	})
+})
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// ReadCABundle returns a pool of the pem encoded certs in the file
+func ReadCABundle(path string) (*x509.CertPool, error) {
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("%s: no pem encoded certs found", path)
+	}
+	return pool, nil
+}
+
+// verify checks the certs the server presented against RootCAs (the system roots if nil), every problem is
+// a row. It returns the verified chain, or the presented certs if none could be built
+func (d *DomainVerifier) verify(host string, serverName string, certs []*x509.Certificate, now time.Time) ([]*x509.Certificate, []Row) {
+	if len(certs) == 0 {
+		return nil, []Row{{Status: critical, Host: host, Type: "Chain", Message: "No certs presented"}}
+	}
+
+	var rows []Row
+	leaf := certs[0]
+	if err := leaf.VerifyHostname(serverName); err != nil {
+		rows = append(rows, Row{Status: critical, Host: host, Type: "Hostname",
+			Message: fmt.Sprintf("Cert isn't valid for %s, dns names: %v, %s", serverName, leaf.DNSNames, describe(leaf))})
+	}
+
+	for i, cert := range certs {
+		position := certPosition(i, cert)
+		if now.After(cert.NotAfter) {
+			rows = append(rows, Row{Status: critical, Host: host, Type: "Expired",
+				Message: fmt.Sprintf("%s expired at %s, %s", position, cert.NotAfter, describe(cert))})
+		}
+		if now.Before(cert.NotBefore) {
+			rows = append(rows, Row{Status: critical, Host: host, Type: "Expired",
+				Message: fmt.Sprintf("%s isn't valid before %s, %s", position, cert.NotBefore, describe(cert))})
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	// Expiry is reported above, the chain is verified at a time every presented cert is valid so that
+	// an expired cert doesn't hide the problems of the chain
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         d.RootCAs,
+		Intermediates: intermediates,
+		CurrentTime:   validTime(certs, now),
+	})
+	if err == nil {
+		return chains[0], rows
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority) && unknownAuthority.Cert == leaf && !selfSigned(leaf):
+		rows = append(rows, Row{Status: critical, Host: host, Type: "Chain",
+			Message: fmt.Sprintf("Incomplete chain, the issuer of the leaf (%s) isn't sent by the server, %s", leaf.Issuer, describe(leaf))})
+	case errors.As(err, &unknownAuthority) && unknownAuthority.Cert != nil:
+		rows = append(rows, Row{Status: critical, Host: host, Type: "Authority",
+			Message: fmt.Sprintf("Unknown authority %s, %s", unknownAuthority.Cert.Issuer, describe(unknownAuthority.Cert))})
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		// the validity periods don't overlap, already reported
+	case errors.As(err, &invalid) && invalid.Cert != nil:
+		rows = append(rows, Row{Status: critical, Host: host, Type: "Chain",
+			Message: fmt.Sprintf("%s, %s", err, describe(invalid.Cert))})
+	default:
+		rows = append(rows, Row{Status: critical, Host: host, Type: "Chain", Message: err.Error()})
+	}
+	return certs, rows
+}
+
+// validTime is now if every cert is valid now, otherwise the latest start of their validity periods
+func validTime(certs []*x509.Certificate, now time.Time) time.Time {
+	valid := true
+	latest := certs[0].NotBefore
+	for _, cert := range certs {
+		if now.After(cert.NotAfter) || now.Before(cert.NotBefore) {
+			valid = false
+		}
+		if cert.NotBefore.After(latest) {
+			latest = cert.NotBefore
+		}
+	}
+	if valid {
+		return now
+	}
+	return latest
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+func certPosition(i int, cert *x509.Certificate) string {
+	switch {
+	case i == 0:
+		return "Leaf"
+	case selfSigned(cert):
+		return "Root"
+	default:
+		return "Intermediate"
+	}
+}
+
+// describe identifies the cert the way openssl x509 -text does
+func describe(cert *x509.Certificate) string {
+	var serial []string
+	for _, b := range cert.SerialNumber.Bytes() {
+		serial = append(serial, fmt.Sprintf("%02X", b))
+	}
+	return fmt.Sprintf("subject: %s, issuer: %s, serial: %s", cert.Subject, cert.Issuer, strings.Join(serial, ":"))
+}
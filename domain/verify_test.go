@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var serial int64 = 0x1000
+
+// issue creates a cert for the name, a dns name or ip address, signed by the parent, self-signed without one.
+// Every cert is valid from two days ago and can sign other certs
+func issue(name string, parent *testCert, notAfter time.Time) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	serial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return &testCert{cert: cert, key: key}
+}
+
+// chain is what the server presents, the cert followed by the intermediates
+func (c *testCert) chain(intermediates ...*testCert) tls.Certificate {
+	chain := tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+	for _, intermediate := range intermediates {
+		chain.Certificate = append(chain.Certificate, intermediate.cert.Raw)
+	}
+	return chain
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+var _ = Describe("Verification", func() {
+	nextYear := time.Now().Add(365 * 24 * time.Hour)
+	var root, intermediate, leaf *testCert
+	var d *DomainVerifier
+
+	BeforeEach(func() {
+		root = issue("Janitor Root", nil, nextYear)
+		intermediate = issue("Janitor Intermediate", root, nextYear)
+		leaf = issue("leaf.example.com", intermediate, nextYear)
+		d = &DomainVerifier{Ui: cli.NewMockUi(), Timeout: 5 * time.Second, RootCAs: root.pool()}
+	})
+
+	validate := func(chain tls.Certificate, sni string) []Row {
+		return d.ValidateCert(serve(chain, nil)+" sni="+sni, time.Now())
+	}
+
+	types := func(rows []Row) []string {
+		var types []string
+		for _, row := range rows {
+			types = append(types, row.Status+" "+row.Type)
+		}
+		return types
+	}
+
+	It("accepts a complete chain", func() {
+		rows := validate(leaf.chain(intermediate), "leaf.example.com")
+		Expect(types(rows)).To(Equal([]string{"OK Certificate"}))
+	})
+
+	It("reports a hostname mismatch", func() {
+		rows := validate(leaf.chain(intermediate), "other.example.com")
+		Expect(types(rows)).To(Equal([]string{"CRITICAL Hostname", "OK Certificate"}))
+		Expect(rows[0].Message).To(ContainSubstring("Cert isn't valid for other.example.com, dns names: [leaf.example.com]"))
+	})
+
+	It("reports an incomplete chain", func() {
+		rows := validate(leaf.chain(), "leaf.example.com")
+		Expect(types(rows)).To(Equal([]string{"CRITICAL Chain", "OK Certificate"}))
+		Expect(rows[0].Message).To(HavePrefix("Incomplete chain, the issuer of the leaf (CN=Janitor Intermediate) isn't sent by the server"))
+	})
+
+	It("reports an unknown authority with the cert", func() {
+		d.RootCAs = issue("Other Root", nil, nextYear).pool()
+		rows := validate(leaf.chain(intermediate), "leaf.example.com")
+		Expect(types(rows)).To(Equal([]string{"CRITICAL Authority", "OK Certificate"}))
+		Expect(rows[0].Message).To(Equal(describeExpected("Unknown authority CN=Janitor Root", intermediate.cert)))
+
+		self := issue("self.example.com", nil, nextYear)
+		rows = validate(self.chain(), "self.example.com")
+		Expect(types(rows)).To(Equal([]string{"CRITICAL Authority", "OK Certificate"}))
+	})
+
+	It("reports an expired leaf and intermediate", func() {
+		expiredIntermediate := issue("Janitor Intermediate", root, time.Now().Add(-time.Hour))
+		expiredLeaf := issue("leaf.example.com", expiredIntermediate, time.Now().Add(-2*time.Hour))
+		rows := validate(expiredLeaf.chain(expiredIntermediate), "leaf.example.com")
+		Expect(types(rows)).To(Equal([]string{"CRITICAL Expired", "CRITICAL Expired"}))
+		Expect(rows[0].Message).To(HavePrefix("Leaf expired at "))
+		Expect(rows[0].Message).To(HaveSuffix(", subject: CN=leaf.example.com, issuer: CN=Janitor Intermediate, serial: " + serialOf(expiredLeaf.cert)))
+		Expect(rows[1].Message).To(HavePrefix("Intermediate expired at "))
+	})
+
+	It("matches wildcards and ip addresses", func() {
+		wildcard := issue("*.example.com", intermediate, nextYear)
+		Expect(types(validate(wildcard.chain(intermediate), "leaf.example.com"))).To(Equal([]string{"OK Certificate"}))
+		Expect(types(validate(wildcard.chain(intermediate), "a.leaf.example.com"))).To(Equal([]string{"CRITICAL Hostname", "OK Certificate"}))
+
+		ip := issue("127.0.0.1", intermediate, nextYear)
+		rows := d.ValidateCert(serve(ip.chain(intermediate), nil), time.Now())
+		Expect(types(rows)).To(Equal([]string{"OK Certificate"}))
+		Expect(rows[0].Message).To(ContainSubstring("[127.0.0.1]"))
+	})
+
+	It("grades every cert of the chain by the thresholds", func() {
+		d.WarnWithin, d.CriticalWithin = 30*day, 7*day
+		soonRoot := issue("Janitor Root", nil, time.Now().Add(20*day))
+		soonIntermediate := issue("Janitor Intermediate", soonRoot, time.Now().Add(5*day))
+		leaf := issue("leaf.example.com", soonIntermediate, nextYear)
+		d.RootCAs = soonRoot.pool()
+
+		rows := validate(leaf.chain(soonIntermediate), "leaf.example.com")
+		Expect(types(rows)).To(Equal([]string{"OK Certificate", "CRITICAL Certificate", "WARNING Certificate"}))
+		Expect(rows[1].Message).To(HavePrefix("Intermediate expiring within 7d at "))
+		Expect(rows[1].Message).To(HaveSuffix(describe(soonIntermediate.cert)))
+		Expect(rows[2].Message).To(HavePrefix("Root expiring within 30d at "))
+
+		d.WarnWithin, d.CriticalWithin = 0, 0
+		rows = validate(leaf.chain(soonIntermediate), "leaf.example.com")
+		Expect(types(rows)).To(Equal([]string{"OK Certificate", "WARNING Certificate", "WARNING Certificate"}))
+		Expect(rows[1].Message).To(HavePrefix("Intermediate expires before the leaf at "))
+	})
+
+	It("reports an expired cert once", func() {
+		d.WarnWithin = 30 * day
+		expired := issue("leaf.example.com", intermediate, time.Now().Add(-time.Hour))
+		Expect(types(validate(expired.chain(intermediate), "leaf.example.com"))).To(Equal([]string{"CRITICAL Expired"}))
+	})
+
+	It("reads the roots from a ca bundle", func() {
+		dir, err := ioutil.TempDir("", "janitor-domain")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "bundle.pem")
+		Expect(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw}), 0600)).To(Succeed())
+		d.RootCAs, err = ReadCABundle(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(types(validate(leaf.chain(intermediate), "leaf.example.com"))).To(Equal([]string{"OK Certificate"}))
+
+		Expect(ioutil.WriteFile(path, []byte("not a cert"), 0600)).To(Succeed())
+		_, err = ReadCABundle(path)
+		Expect(err).To(MatchError(ContainSubstring("no pem encoded certs found")))
+	})
+})
+
+// serialOf formats the serial like openssl, 10:2A
+func serialOf(cert *x509.Certificate) string {
+	hex := fmt.Sprintf("%X", cert.SerialNumber)
+	if len(hex)%2 == 1 {
+		hex = "0" + hex
+	}
+	var pairs []string
+	for i := 0; i < len(hex); i += 2 {
+		pairs = append(pairs, hex[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+func describeExpected(prefix string, cert *x509.Certificate) string {
+	return prefix + ", subject: " + cert.Subject.String() + ", issuer: " + cert.Issuer.String() + ", serial: " + serialOf(cert)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/freddd/janitor/tfa"
 	"github.com/freddd/janitor/domain"
 	"github.com/freddd/janitor/mining"
+	"github.com/freddd/janitor/config"
 )
 
 func main() {
@@ -40,6 +41,12 @@ func main() {
 				Ui: getUi(ui),
 			}, nil
 		},
+		"config": func() (cli.Command, error) {
+			return &config.ConfigCommand{
+				Ui:           getUi(ui),
+				BuiltinRules: tracker.BuiltinRules,
+			}, nil
+		},
 	}
 
 	exitStatus, err := c.Run()
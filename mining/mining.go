@@ -2,7 +2,9 @@ package mining
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"github.com/freddd/janitor/config"
 	"github.com/freddd/janitor/util"
 	"github.com/mitchellh/cli"
 	"os"
@@ -15,11 +17,33 @@ const (
 	ipRegexp string = `(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])`
 )
 
+var defaultIgnore = []string{"vendor", ".git", "node_modules"}
+
 type Mining struct {
 	Ui cli.Ui
 }
 
 func (m *Mining) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("mining", flag.ExitOnError)
+	cmdFlags.Usage = func() { m.Ui.Output(m.Help()) }
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "mining")
+	if err != nil {
+		m.Ui.Error(err.Error())
+		return 1
+	}
+	ignore := cfg.Mining.Ignore
+	if len(ignore) == 0 {
+		ignore = defaultIgnore
+	}
+
 	m.Ui.Info("---------- Mining information: ---------------------------")
 	pathToRepo, err := util.CurrentDir()
 	if err != nil {
@@ -28,7 +52,7 @@ func (m *Mining) Run(args []string) int {
 	}
 
 	m.Ui.Info(fmt.Sprintf("Running on path: %s", pathToRepo))
-	files, err := util.FindAllFiles(pathToRepo, []string{"vendor", ".git", "node_modules"})
+	files, err := util.FindAllFilesSkipping(pathToRepo, ignore)
 	if err != nil {
 		m.Ui.Error(err.Error())
 	}
@@ -94,6 +118,9 @@ func (m *Mining) Help() string {
 	helpText := `
 		Usage: janitor mining
 		  Mining the current directory for information (usually done in a repo)
+		Options:
+		  -cfg  the global config file, defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml,
+		        mining.ignore are the directories skipped (defaults to vendor, .git and node_modules)
 		`
 
 	return strings.TrimSpace(helpText)
@@ -0,0 +1,214 @@
+package tfa
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type All struct {
+	Ui cli.Ui
+	// Providers default to the ones configured with env variables or the config
+	Providers []Provider
+	// Out receives the tables, defaults to stdout
+	Out io.Writer
+}
+
+func (all *All) out() io.Writer {
+	if all.Out == nil {
+		return os.Stdout
+	}
+	return all.Out
+}
+
+func (all *All) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("all", flag.ExitOnError)
+	cmdFlags.Usage = func() { all.Ui.Output(all.Help()) }
+	timeout := 10 * time.Minute
+	strict := false
+	historyFile := DefaultHistoryFile
+	cmdFlags.DurationVar(&timeout, "timeout", timeout, "How long to wait for the providers")
+	cmdFlags.BoolVar(&strict, "strict", false, "Flag admins with weak factors and fail if any admin lacks TFA")
+	cmdFlags.StringVar(&historyFile, "history", historyFile, "The file the run is recorded in, empty to not record it")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		all.Ui.Error(err.Error())
+		return 1
+	}
+	set := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["history"] && cfg.Tfa.HistoryFile != "" {
+		historyFile = cfg.Tfa.HistoryFile
+	}
+
+	providers := all.Providers
+	if providers == nil {
+		providers = ConfiguredProviders(all.Ui, cfg.Tfa)
+	}
+	if len(providers) == 0 {
+		all.Ui.Error("No providers configured")
+		cmdFlags.Usage()
+		return 1
+	}
+
+	all.Ui.Info("---------- Finding users without TFA in all providers: ----------")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	results := RunProviders(ctx, providers)
+
+	exitStatus := 0
+	for _, result := range results {
+		if result.Err != nil {
+			all.Ui.Error(fmt.Sprintf("CRITICAL: %s: %s", result.Provider, result.Err))
+			exitStatus = 1
+		}
+	}
+
+	if historyFile != "" && !all.record(ctx, historyFile, providers, results) {
+		exitStatus = 1
+	}
+
+	people := Merge(results)
+	if len(people) == 0 && exitStatus == 0 {
+		all.Ui.Info("OK: All users have TFA enabled")
+	}
+	if len(people) > 0 {
+		table := tablewriter.NewWriter(all.out())
+		table.SetHeader([]string{"Email", "Name", "Admin", "Accounts"})
+		for _, person := range people {
+			table.Append([]string{person.Email, person.Name, strconv.FormatBool(person.Admin), accounts(person.Accounts)})
+		}
+		table.Render()
+		all.Ui.Warn(fmt.Sprintf("WARNING: %d people without TFA", len(people)))
+	}
+
+	if !strict {
+		return exitStatus
+	}
+
+	if all.weakFactors(ctx, providers) {
+		exitStatus = 1
+	}
+
+	admins := 0
+	for _, person := range people {
+		if person.Admin {
+			admins++
+		}
+	}
+	if admins > 0 {
+		all.Ui.Error(fmt.Sprintf("CRITICAL: %d admins without TFA", admins))
+		exitStatus = 1
+	}
+	return exitStatus
+}
+
+// record appends the providers that succeeded to the history, returns false if it couldn't be written
+func (all *All) record(ctx context.Context, path string, providers []Provider, results []Result) bool {
+	run := Run{Time: time.Now().UTC()}
+	var succeeded []Provider
+	for i, result := range results {
+		if result.Err == nil {
+			run.Providers = append(run.Providers, result.Provider)
+			run.Accounts = append(run.Accounts, result.Accounts...)
+			succeeded = append(succeeded, providers[i])
+		}
+	}
+	if len(succeeded) == 0 {
+		return true
+	}
+
+	members, err := RunMemberProviders(ctx, succeeded)
+	if err != nil {
+		all.Ui.Warn(fmt.Sprintf("Unable to list the members, the history can't tell who joined: %s", err))
+	}
+	run.Members = members
+
+	if err := AppendRun(path, run); err != nil {
+		all.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return false
+	}
+	return true
+}
+
+// weakFactors prints the admins that only have weak factors, returns true if any provider failed
+func (all *All) weakFactors(ctx context.Context, providers []Provider) bool {
+	failed := false
+	var admins []Account
+	for _, result := range RunFactorProviders(ctx, providers) {
+		if result.Err != nil {
+			all.Ui.Error(fmt.Sprintf("CRITICAL: %s: %s", result.Provider, result.Err))
+			failed = true
+		}
+		admins = append(admins, result.Accounts...)
+	}
+
+	if len(admins) == 0 {
+		return failed
+	}
+
+	table := tablewriter.NewWriter(all.out())
+	table.SetHeader([]string{"Email", "Name", "Account", "Factors"})
+	for _, admin := range admins {
+		table.Append([]string{admin.Email, admin.Name, accounts([]Account{admin}), strings.Join(admin.Factors, ", ")})
+	}
+	table.Render()
+	all.Ui.Warn(fmt.Sprintf("WARNING: %d admins with weak factors only", len(admins)))
+	return failed
+}
+
+func accounts(accounts []Account) string {
+	var formatted []string
+	for _, account := range accounts {
+		if account.Role != "" {
+			formatted = append(formatted, fmt.Sprintf("%s (%s, %s)", account.Provider, account.Login, account.Role))
+		} else {
+			formatted = append(formatted, fmt.Sprintf("%s (%s)", account.Provider, account.Login))
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func (all *All) Help() string {
+	helpText := `
+		Usage: janitor tfa all
+		  Checks TFA in every configured provider at once and merges the users by email into one report
+		  A provider is configured when its env variables, or its section under tfa in the config, are set:
+		    github  GITHUB_KEY and GITHUB_ORG
+		    gsuite  GSUITE_KEY and GSUITE_SUBJECT
+		    gitlab  GITLAB_TOKEN (and GITLAB_URL for a self-managed instance)
+		    slack   SLACK_TOKEN
+		    okta    OKTA_TOKEN and OKTA_URL
+		    bitbucket BITBUCKET_TOKEN and BITBUCKET_WORKSPACE
+		Options:
+		  --timeout how long to wait for the providers (defaults to 10m)
+		  --cfg     the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml)
+		  --history the file each run is recorded in for janitor tfa history (defaults to tfa.historyFile of the
+		            config or .janitor-tfa-history.jsonl), set it to an empty string to not record the run. Only the
+		            runs of janitor tfa all are recorded, run it for one provider by configuring only that one
+		  --strict  also list the admins with nothing but weak factors (sms, call, email or question) in the
+		            providers that expose factors (okta and slack) and exit with 1 if any admin lacks TFA
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (all *All) Synopsis() string {
+	return "Check TFA status in all configured providers"
+}
@@ -0,0 +1,220 @@
+package atlassian
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"github.com/parnurzeal/gorequest"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultBaseUrl     = "https://api.bitbucket.org/"
+	BitbucketToken     = "BITBUCKET_TOKEN"
+	BitbucketWorkspace = "BITBUCKET_WORKSPACE"
+	permissionsPath    = "2.0/workspaces/%s/permissions?pagelen=100"
+	owner              = "owner"
+)
+
+type User struct {
+	AccountID   string `json:"account_id"`
+	UUID        string `json:"uuid"`
+	Nickname    string `json:"nickname"`
+	DisplayName string `json:"display_name"`
+	Has2FA      *bool  `json:"has_2fa_enabled"`
+	Links       struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+// Membership is the permission (owner, collaborator or member) of a user in a workspace
+type Membership struct {
+	Permission string `json:"permission"`
+	User       User   `json:"user"`
+}
+
+func (membership Membership) Admin() bool {
+	return membership.Permission == owner
+}
+
+type PermissionsResponse struct {
+	Values []Membership `json:"values"`
+	Next   string       `json:"next"`
+}
+
+type Bitbucket struct {
+	Ui cli.Ui
+	// BaseUrl defaults to DefaultBaseUrl
+	BaseUrl string
+}
+
+// FindAllUsersWithoutTFA lists the members of the workspace without two-step verification. It's an error if
+// has_2fa_enabled isn't visible for a member, they would look like they have it
+func (bitbucket *Bitbucket) FindAllUsersWithoutTFA(workspace string, token string) ([]Membership, error) {
+	members, err := bitbucket.FindAllMembers(workspace, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var without []Membership
+	var unknown []string
+	for _, membership := range members {
+		switch {
+		case membership.User.Has2FA == nil:
+			unknown = append(unknown, membership.User.Nickname)
+		case !*membership.User.Has2FA:
+			without = append(without, membership)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("has_2fa_enabled of %s isn't visible, the token needs the account scope", strings.Join(unknown, ", "))
+	}
+	return without, nil
+}
+
+// FindAllMembers lists every member of the workspace with their permission
+// https://developer.atlassian.com/cloud/bitbucket/rest/api-group-workspaces/#api-workspaces-workspace-permissions-get
+func (bitbucket *Bitbucket) FindAllMembers(workspace string, token string) ([]Membership, error) {
+	var members []Membership
+	targetUrl := bitbucket.baseUrl() + fmt.Sprintf(permissionsPath, workspace)
+	for targetUrl != "" {
+		res, body, errs := gorequest.New().
+			Get(targetUrl).
+			Set("Authorization", fmt.Sprintf("Bearer %s", token)).
+			End()
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		if res.StatusCode != 200 {
+			return nil, fmt.Errorf("got status code %d from Bitbucket: %s", res.StatusCode, errorMessage(body))
+		}
+
+		response := PermissionsResponse{}
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			return nil, err
+		}
+		members = append(members, response.Values...)
+		targetUrl = response.Next
+	}
+	return members, nil
+}
+
+func errorMessage(body string) string {
+	response := struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || response.Error.Message == "" {
+		return strings.TrimSpace(body)
+	}
+	return response.Error.Message
+}
+
+func (bitbucket *Bitbucket) baseUrl() string {
+	if bitbucket.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	if !strings.HasSuffix(bitbucket.BaseUrl, "/") {
+		return bitbucket.BaseUrl + "/"
+	}
+	return bitbucket.BaseUrl
+}
+
+func (bitbucket *Bitbucket) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("bitbucket", flag.ExitOnError)
+	cmdFlags.Usage = func() { bitbucket.Ui.Output(bitbucket.Help()) }
+	token := ""
+	workspace := ""
+	cmdFlags.StringVar(&token, "token", "", "The access token")
+	cmdFlags.StringVar(&workspace, "workspace", "", "The workspace")
+	cmdFlags.StringVar(&bitbucket.BaseUrl, "baseUrl", DefaultBaseUrl, "The base url of the api")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		bitbucket.Ui.Error(err.Error())
+		return 1
+	}
+	set := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["baseUrl"] && cfg.Tfa.Bitbucket.BaseUrl != "" {
+		bitbucket.BaseUrl = cfg.Tfa.Bitbucket.BaseUrl
+	}
+
+	if token == "" {
+		token = os.Getenv(BitbucketToken)
+	}
+	if token == "" {
+		token = cfg.Tfa.Bitbucket.Token
+		if token == "" {
+			cmdFlags.Usage()
+			return 1
+		}
+	}
+
+	if workspace == "" {
+		workspace = os.Getenv(BitbucketWorkspace)
+	}
+	if workspace == "" {
+		workspace = cfg.Tfa.Bitbucket.Workspace
+		if workspace == "" {
+			cmdFlags.Usage()
+			return 1
+		}
+	}
+
+	bitbucket.Ui.Info(fmt.Sprintf("---------- Finding members of %s on Bitbucket without TFA: ----------", workspace))
+	members, err := bitbucket.FindAllUsersWithoutTFA(workspace, token)
+	if err != nil {
+		bitbucket.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	if len(members) == 0 {
+		bitbucket.Ui.Info("OK: All members have TFA enabled")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Nickname", "Name", "Admin", "Profile"})
+	for _, membership := range members {
+		table.Append([]string{membership.User.Nickname, membership.User.DisplayName,
+			strconv.FormatBool(membership.Admin()), membership.User.Links.HTML.Href})
+	}
+	table.Render()
+	bitbucket.Ui.Warn(fmt.Sprintf("WARNING: %d members without TFA", len(members)))
+	return 0
+}
+
+func (bitbucket *Bitbucket) Help() string {
+	helpText := `
+		Usage: janitor tfa bitbucket --token <token> --workspace <workspace>
+		  Gets the current status of TFA usage in a bitbucket (atlassian) workspace
+		Options:
+		  --token     a workspace access token with the account scope (can also be set using the BITBUCKET_TOKEN env variable)
+		  --workspace the workspace we aim to get the info from (can also be set using the BITBUCKET_WORKSPACE env variable)
+		  --baseUrl   the base url of the api (defaults to https://api.bitbucket.org/)
+		  --cfg       the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml),
+		              used for the options that aren't given as flags or env variables
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (bitbucket *Bitbucket) Synopsis() string {
+	return "Check TFA status in bitbucket"
+}
@@ -0,0 +1,82 @@
+package atlassian_test
+
+import (
+	"fmt"
+	"github.com/freddd/janitor/tfa/atlassian"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAtlassian(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AtlassianSuite")
+}
+
+var _ = Describe("Bitbucket members without TFA", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"type":"error","error":{"message":"Access token expired."}}`)
+				return
+			}
+			if r.URL.Path == "/2.0/workspaces/hidden/permissions" {
+				fmt.Fprint(w, `{"values":[
+					{"permission":"member","user":{"nickname":"bob","has_2fa_enabled":true}},
+					{"permission":"collaborator","user":{"nickname":"dave","display_name":"Dave"}}
+				]}`)
+				return
+			}
+
+			if r.URL.Query().Get("page") == "" {
+				fmt.Fprintf(w, `{"values":[
+					{"permission":"owner","user":{"nickname":"alice","has_2fa_enabled":false}},
+					{"permission":"member","user":{"nickname":"bob","has_2fa_enabled":true}}
+				],"next":"%s/2.0/workspaces/acme/permissions?page=2"}`, server.URL)
+				return
+			}
+			fmt.Fprint(w, `{"values":[
+				{"permission":"member","user":{"nickname":"carol","has_2fa_enabled":false}},
+				{"permission":"collaborator","user":{"nickname":"dave","display_name":"Dave","has_2fa_enabled":true}}
+			]}`)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("follows the next links", func() {
+		b := &atlassian.Bitbucket{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		members, err := b.FindAllUsersWithoutTFA("acme", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(HaveLen(2))
+		Expect(members[0].User.Nickname).To(Equal("alice"))
+		Expect(members[0].Admin()).To(BeTrue())
+		Expect(members[1].User.Nickname).To(Equal("carol"))
+	})
+
+	It("fails if it can't see whether a member has TFA", func() {
+		b := &atlassian.Bitbucket{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := b.FindAllUsersWithoutTFA("hidden", "secret")
+		Expect(err).To(MatchError("has_2fa_enabled of dave isn't visible, the token needs the account scope"))
+
+		ui := cli.NewMockUi()
+		b = &atlassian.Bitbucket{Ui: ui}
+		Expect(b.Run([]string{"-token", "secret", "-workspace", "hidden", "-baseUrl", server.URL})).To(Equal(1))
+		Expect(ui.OutputWriter.String()).NotTo(ContainSubstring("OK"))
+		Expect(ui.ErrorWriter.String()).To(ContainSubstring("CRITICAL: has_2fa_enabled of dave isn't visible"))
+	})
+
+	It("returns the error message of the api", func() {
+		b := &atlassian.Bitbucket{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := b.FindAllUsersWithoutTFA("acme", "wrong")
+		Expect(err).To(MatchError("got status code 401 from Bitbucket: Access token expired."))
+	})
+})
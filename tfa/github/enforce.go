@@ -0,0 +1,199 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/parnurzeal/gorequest"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultStateFile = ".janitor-tfa-state.json"
+	DefaultGraceDays = 14
+
+	Notify string = "notify"
+	Wait   string = "wait"
+	Remove string = "remove"
+
+	issuesPath              = "repos/%s/issues"
+	memberPath              = "orgs/%s/members/%s"
+	outsideCollaboratorPath = "orgs/%s/outside_collaborators/%s"
+)
+
+// Offender is an account that has been seen without TFA, NotifiedAt is nil until an issue mentioning the
+// account has been created
+type Offender struct {
+	FirstSeen  time.Time  `json:"firstSeen"`
+	NotifiedAt *time.Time `json:"notifiedAt,omitempty"`
+}
+
+// State is kept between runs to know when the grace period of an account started
+type State struct {
+	Offenders map[string]*Offender `json:"offenders"`
+}
+
+// Action is what enforcement does to an account, Deadline is when the grace period expires
+type Action struct {
+	Account  Account
+	Kind     string
+	Deadline time.Time
+}
+
+func (action Action) String() string {
+	switch action.Kind {
+	case Notify:
+		return fmt.Sprintf("notify %s to enable TFA before %s", action.Account.Login, action.Deadline.Format("2006-01-02"))
+	case Remove:
+		if action.Account.Outside {
+			return fmt.Sprintf("remove outside collaborator %s, the grace period expired %s", action.Account.Login, action.Deadline.Format("2006-01-02"))
+		}
+		return fmt.Sprintf("remove member %s, the grace period expired %s", action.Account.Login, action.Deadline.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("wait for %s to enable TFA until %s", action.Account.Login, action.Deadline.Format("2006-01-02"))
+}
+
+// Enforcement removes accounts without TFA once the grace period after they were notified (mentioned in an
+// issue in IssueRepo) has expired, an account is notified the first time it's seen
+type Enforcement struct {
+	Organization string
+	// IssueRepo is owner/repo, required unless it's a dry run since nobody can be removed without a notification
+	IssueRepo string
+	Grace     time.Duration
+	StateFile string
+	DryRun    bool
+}
+
+// ReadState returns an empty state if the file doesn't exist yet
+func ReadState(path string) (*State, error) {
+	state := &State{Offenders: map[string]*Offender{}}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if state.Offenders == nil {
+		state.Offenders = map[string]*Offender{}
+	}
+	return state, nil
+}
+
+func WriteState(path string, state *State) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0600)
+}
+
+// Plan updates the state with the accounts seen now and returns what to do with each of them, accounts
+// that have enabled TFA since the last run are forgotten. An account is never removed before it has been
+// notified, the grace period starts with the notification
+func Plan(accounts []Account, state *State, now time.Time, grace time.Duration) []Action {
+	seen := map[string]bool{}
+	var actions []Action
+	for _, account := range accounts {
+		seen[account.Login] = true
+		offender, ok := state.Offenders[account.Login]
+		if !ok {
+			offender = &Offender{FirstSeen: now}
+			state.Offenders[account.Login] = offender
+		}
+
+		if offender.NotifiedAt == nil {
+			actions = append(actions, Action{Account: account, Kind: Notify, Deadline: now.Add(grace)})
+			continue
+		}
+		action := Action{Account: account, Kind: Wait, Deadline: offender.NotifiedAt.Add(grace)}
+		if !now.Before(action.Deadline) {
+			action.Kind = Remove
+		}
+		actions = append(actions, action)
+	}
+
+	for login := range state.Offenders {
+		if !seen[login] {
+			delete(state.Offenders, login)
+		}
+	}
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Deadline.Before(actions[j].Deadline)
+	})
+	return actions
+}
+
+// Enforce plans the actions and, unless it's a dry run, performs them and saves the state. A dry run
+// doesn't touch the state file either, so the grace period starts with the first real run
+func (github *GitHub) Enforce(enforcement Enforcement, accounts []Account, apiKey string) ([]Action, error) {
+	if !enforcement.DryRun && enforcement.IssueRepo == "" {
+		return nil, fmt.Errorf("enforcing requires an issue repo to notify the accounts in before they can be removed")
+	}
+	state, err := ReadState(enforcement.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	actions := Plan(accounts, state, now, enforcement.Grace)
+	if enforcement.DryRun {
+		return actions, nil
+	}
+
+	var notify []Action
+	for _, action := range actions {
+		switch action.Kind {
+		case Notify:
+			notify = append(notify, action)
+		case Remove:
+			if err := github.remove(enforcement.Organization, action.Account, apiKey); err != nil {
+				return actions, err
+			}
+			delete(state.Offenders, action.Account.Login)
+		}
+	}
+
+	if len(notify) > 0 {
+		if err := github.createIssue(enforcement.IssueRepo, notify, apiKey); err != nil {
+			return actions, err
+		}
+		for _, action := range notify {
+			state.Offenders[action.Account.Login].NotifiedAt = &now
+		}
+	}
+
+	return actions, WriteState(enforcement.StateFile, state)
+}
+
+func (github *GitHub) remove(organization string, account Account, apiKey string) error {
+	path := memberPath
+	if account.Outside {
+		path = outsideCollaboratorPath
+	}
+	_, _, err := github.request(gorequest.DELETE, github.baseUrl()+fmt.Sprintf(path, organization, account.Login), apiKey, nil)
+	return err
+}
+
+// createIssue opens one issue mentioning everyone that was notified in this run
+func (github *GitHub) createIssue(repo string, actions []Action, apiKey string) error {
+	body := "The following accounts don't have two-factor authentication enabled and will be removed from the organization unless it is enabled before the deadline:\n\n"
+	for _, action := range actions {
+		body += fmt.Sprintf("- [ ] @%s (%s)\n", action.Account.Login, action.Deadline.Format("2006-01-02"))
+	}
+	body += "\nSee https://help.github.com/articles/securing-your-account-with-two-factor-authentication-2fa/"
+
+	issue := map[string]string{
+		"title": "Enable two-factor authentication",
+		"body":  body,
+	}
+	_, _, err := github.request(gorequest.POST, github.baseUrl()+fmt.Sprintf(issuesPath, repo), apiKey, issue)
+	return err
+}
@@ -2,22 +2,37 @@ package github
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
 	"github.com/parnurzeal/gorequest"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"github.com/mitchellh/cli"
-	"flag"
+	"time"
 )
 
 const (
-	BaseUrl = "https://api.github.com/"
-	tfaPath = "orgs/%s/members?filter=2fa_disabled"
-	githubKey = "GITHUB_KEY"
-	githubOrg = "GITHUB_ORG"
+	DefaultBaseUrl    = "https://api.github.com/"
+	tfaPath           = "orgs/%s/members?filter=2fa_disabled&per_page=100"
+	adminTfaPath      = "orgs/%s/members?filter=2fa_disabled&role=admin&per_page=100"
+	membersPath       = "orgs/%s/members?per_page=100"
+	userPath          = "users/%s"
+	outsideTfaPath    = "orgs/%s/outside_collaborators?filter=2fa_disabled&per_page=100"
+	reposPath         = "orgs/%s/repos?type=all&per_page=100"
+	collaboratorsPath = "repos/%s/collaborators?affiliation=all&per_page=100"
+	GithubKey         = "GITHUB_KEY"
+	GithubOrg         = "GITHUB_ORG"
+	maxRetries        = 3
 )
 
-type TFAResponse []struct {
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+type Member struct {
 	Login            string `json:"login"`
 	ID               int    `json:"id"`
 	AvatarURL        string `json:"avatar_url"`
@@ -29,31 +44,293 @@ type TFAResponse []struct {
 	SiteAdmin        bool   `json:"site_admin"`
 }
 
+type TFAResponse []Member
+
+// User is the public profile of an account, Email is only set if the user made it public
+type User struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
 type GitHub struct {
-	Ui  cli.Ui
+	Ui cli.Ui
+	// BaseUrl defaults to DefaultBaseUrl
+	BaseUrl string
 }
 
-func (github *GitHub) FindAllUsersWithoutTFA(organization string, apiKey string) ([]string, []error) {
-	targetUrl := BaseUrl + fmt.Sprintf(tfaPath, organization)
-	request := gorequest.New()
-	res, body, errs := request.Get(targetUrl).Set("Authorization", fmt.Sprintf("token %s", apiKey)).End()
+type Repository struct {
+	FullName string `json:"full_name"`
+}
+
+type Collaborator struct {
+	Login       string `json:"login"`
+	Permissions struct {
+		Admin    bool `json:"admin"`
+		Maintain bool `json:"maintain"`
+		Push     bool `json:"push"`
+		Triage   bool `json:"triage"`
+		Pull     bool `json:"pull"`
+	} `json:"permissions"`
+}
 
-	if res.StatusCode != 200 {
-		github.Ui.Error(fmt.Sprintf("CRITICAL: Got status code %d from Github", res.StatusCode))
+// Permission maps the fine grained permissions to admin, write or read
+func (c Collaborator) Permission() string {
+	switch {
+	case c.Permissions.Admin:
+		return "admin"
+	case c.Permissions.Maintain || c.Permissions.Push:
+		return "write"
 	}
-	if errs != nil && len(errs) > 0 {
-		return nil, errs
+	return "read"
+}
+
+// Account is a member or outside collaborator without TFA and the repositories it can access
+type Account struct {
+	Member
+	Outside bool
+	// Repositories are keyed by permission (admin, write or read)
+	Repositories map[string][]string
+}
+
+func (github *GitHub) FindAllUsersWithoutTFA(organization string, apiKey string) ([]Member, error) {
+	return github.findMembers(fmt.Sprintf(tfaPath, organization), apiKey)
+}
+
+// FindAllMembers finds every member, with or without TFA
+func (github *GitHub) FindAllMembers(organization string, apiKey string) ([]Member, error) {
+	return github.findMembers(fmt.Sprintf(membersPath, organization), apiKey)
+}
+
+// FindAllAdminsWithoutTFA finds the owners of the organization without TFA
+func (github *GitHub) FindAllAdminsWithoutTFA(organization string, apiKey string) ([]Member, error) {
+	return github.findMembers(fmt.Sprintf(adminTfaPath, organization), apiKey)
+}
+
+func (github *GitHub) FindUser(login string, apiKey string) (User, error) {
+	user := User{}
+	body, _, err := github.get(github.baseUrl()+fmt.Sprintf(userPath, login), apiKey)
+	if err != nil {
+		return user, err
 	}
+	err = json.Unmarshal([]byte(body), &user)
+	return user, err
+}
 
-	response := TFAResponse{}
-	json.Unmarshal([]byte(body), &response)
+// FindOutsideCollaboratorsWithoutTFA finds the collaborators that aren't members, the org's TFA requirement
+// doesn't apply to them
+func (github *GitHub) FindOutsideCollaboratorsWithoutTFA(organization string, apiKey string) ([]Member, error) {
+	return github.findMembers(fmt.Sprintf(outsideTfaPath, organization), apiKey)
+}
 
-	users := make([]string, len(response))
-	for _, user := range response {
-		users = append(users, user.Login)
+func (github *GitHub) findMembers(path string, apiKey string) ([]Member, error) {
+	var members []Member
+	err := github.list(github.baseUrl()+path, apiKey, func(body string) error {
+		response := TFAResponse{}
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			return err
+		}
+		members = append(members, response...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return members, nil
+}
+
+// FindRepositoryAccess goes through the collaborators of every repository in the organization and returns
+// the repositories each of the logins can access, keyed by login and permission
+func (github *GitHub) FindRepositoryAccess(organization string, apiKey string, logins []string) (map[string]map[string][]string, error) {
+	access := map[string]map[string][]string{}
+	for _, login := range logins {
+		access[login] = map[string][]string{}
+	}
+
+	var repositories []Repository
+	err := github.list(github.baseUrl()+fmt.Sprintf(reposPath, organization), apiKey, func(body string) error {
+		var page []Repository
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			return err
+		}
+		repositories = append(repositories, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repository := range repositories {
+		err := github.list(github.baseUrl()+fmt.Sprintf(collaboratorsPath, repository.FullName), apiKey, func(body string) error {
+			var collaborators []Collaborator
+			if err := json.Unmarshal([]byte(body), &collaborators); err != nil {
+				return err
+			}
+			for _, collaborator := range collaborators {
+				if repos, ok := access[collaborator.Login]; ok {
+					permission := collaborator.Permission()
+					repos[permission] = append(repos[permission], repository.FullName)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", repository.FullName, err)
+		}
+	}
+
+	return access, nil
+}
+
+// FindAccountsWithoutTFA combines the members and (optionally) the outside collaborators without TFA, with
+// repos set the accounts are sorted by how exposed they are, the ones with admin access to most repos first
+func (github *GitHub) FindAccountsWithoutTFA(organization string, apiKey string, outside bool, repos bool) ([]Account, error) {
+	members, err := github.FindAllUsersWithoutTFA(organization, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []Account
+	for _, member := range members {
+		accounts = append(accounts, Account{Member: member})
+	}
+
+	if outside {
+		collaborators, err := github.FindOutsideCollaboratorsWithoutTFA(organization, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, collaborator := range collaborators {
+			accounts = append(accounts, Account{Member: collaborator, Outside: true})
+		}
+	}
+
+	if !repos {
+		return accounts, nil
+	}
+
+	var logins []string
+	for _, account := range accounts {
+		logins = append(logins, account.Login)
+	}
+	access, err := github.FindRepositoryAccess(organization, apiKey, logins)
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		accounts[i].Repositories = access[accounts[i].Login]
+	}
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		for _, permission := range []string{"admin", "write", "read"} {
+			a, b := len(accounts[i].Repositories[permission]), len(accounts[j].Repositories[permission])
+			if a != b {
+				return a > b
+			}
+		}
+		return false
+	})
+	return accounts, nil
+}
+
+// list calls page with the body of every page, following the Link header
+func (github *GitHub) list(targetUrl string, apiKey string, page func(body string) error) error {
+	for targetUrl != "" {
+		body, next, err := github.get(targetUrl, apiKey)
+		if err != nil {
+			return err
+		}
+		if err := page(body); err != nil {
+			return err
+		}
+		targetUrl = next
+	}
+	return nil
+}
 
-	return users, nil
+// get returns the body and the url of the next page (if any), waiting for the rate limit to reset when
+// it has been hit
+func (github *GitHub) get(targetUrl string, apiKey string) (string, string, error) {
+	return github.request(gorequest.GET, targetUrl, apiKey, nil)
+}
+
+// request sends payload (if any) as json, any 2xx status is a success
+func (github *GitHub) request(method string, targetUrl string, apiKey string, payload interface{}) (string, string, error) {
+	for attempt := 0; ; attempt++ {
+		req := gorequest.New().
+			CustomMethod(method, targetUrl).
+			Set("Authorization", fmt.Sprintf("token %s", apiKey)).
+			Set("Accept", "application/vnd.github.v3+json")
+		if payload != nil {
+			req = req.Send(payload)
+		}
+		res, body, errs := req.End()
+		if len(errs) > 0 {
+			return "", "", errs[0]
+		}
+
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			next := ""
+			if match := nextLink.FindStringSubmatch(res.Header.Get("Link")); match != nil {
+				next = match[1]
+			}
+			return body, next, nil
+		}
+
+		wait, limited := rateLimitWait(res.StatusCode, res.Header.Get("X-RateLimit-Remaining"),
+			res.Header.Get("X-RateLimit-Reset"), res.Header.Get("Retry-After"))
+		if !limited || attempt >= maxRetries {
+			return "", "", fmt.Errorf("got status code %d from Github: %s", res.StatusCode, errorMessage(body))
+		}
+
+		github.Ui.Warn(fmt.Sprintf("Rate limited by Github, retrying in %s", wait))
+		time.Sleep(wait)
+	}
+}
+
+// rateLimitWait returns how long to wait if the response means that the rate limit has been hit
+func rateLimitWait(statusCode int, remaining string, reset string, retryAfter string) (time.Duration, bool) {
+	if statusCode != 403 && statusCode != 429 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if remaining == "0" {
+		resetAt, err := strconv.ParseInt(reset, 10, 64)
+		if err != nil {
+			return time.Minute, true
+		}
+		wait := time.Unix(resetAt, 0).Sub(time.Now())
+		if wait < 0 {
+			wait = 0
+		}
+		return wait + time.Second, true
+	}
+
+	return 0, false
+}
+
+func errorMessage(body string) string {
+	response := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || response.Message == "" {
+		return strings.TrimSpace(body)
+	}
+	return response.Message
+}
+
+func (github *GitHub) baseUrl() string {
+	if github.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	if !strings.HasSuffix(github.BaseUrl, "/") {
+		return github.BaseUrl + "/"
+	}
+	return github.BaseUrl
 }
 
 func (github *GitHub) Run(args []string) int {
@@ -61,16 +338,54 @@ func (github *GitHub) Run(args []string) int {
 	cmdFlags.Usage = func() { github.Ui.Output(github.Help()) }
 	apiKey := ""
 	organization := ""
+	outside := false
+	repos := false
+	enforce := false
+	enforcement := Enforcement{}
+	graceDays := DefaultGraceDays
 	cmdFlags.StringVar(&apiKey, "apiKey", "", "The api key")
 	cmdFlags.StringVar(&organization, "organization", "", "The organization")
+	cmdFlags.StringVar(&github.BaseUrl, "baseUrl", DefaultBaseUrl, "The base url of the api")
+	cmdFlags.BoolVar(&outside, "outside", false, "Include outside collaborators")
+	cmdFlags.BoolVar(&repos, "repos", false, "List the repositories each account can access")
+	cmdFlags.BoolVar(&enforce, "enforce", false, "Notify and eventually remove the accounts without TFA")
+	cmdFlags.BoolVar(&enforcement.DryRun, "dry-run", true, "Only print the planned enforcement actions")
+	cmdFlags.IntVar(&graceDays, "grace-days", DefaultGraceDays, "Days from an account is notified until it's removed")
+	cmdFlags.StringVar(&enforcement.StateFile, "state", DefaultStateFile, "The file keeping track of when accounts were first seen")
+	cmdFlags.StringVar(&enforcement.IssueRepo, "issue-repo", "", "The repo (owner/repo) to open an issue mentioning the accounts in")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
 
 	if err := cmdFlags.Parse(args); err != nil {
 		cmdFlags.Usage()
 		return 1
 	}
 
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		github.Ui.Error(err.Error())
+		return 1
+	}
+	set := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["baseUrl"] && cfg.Tfa.GitHub.BaseUrl != "" {
+		github.BaseUrl = cfg.Tfa.GitHub.BaseUrl
+	}
+	if !set["grace-days"] && cfg.Tfa.GitHub.Enforce.GraceDays != 0 {
+		graceDays = cfg.Tfa.GitHub.Enforce.GraceDays
+	}
+	if !set["state"] && cfg.Tfa.GitHub.Enforce.StateFile != "" {
+		enforcement.StateFile = cfg.Tfa.GitHub.Enforce.StateFile
+	}
+	if !set["issue-repo"] {
+		enforcement.IssueRepo = cfg.Tfa.GitHub.Enforce.IssueRepo
+	}
+
+	if apiKey == "" {
+		apiKey = os.Getenv(GithubKey)
+	}
 	if apiKey == "" {
-		apiKey = os.Getenv(githubKey)
+		apiKey = cfg.Tfa.GitHub.ApiKey
 		if apiKey == "" {
 			cmdFlags.Usage()
 			return 1
@@ -78,17 +393,79 @@ func (github *GitHub) Run(args []string) int {
 	}
 
 	if organization == "" {
-		organization = os.Getenv(githubOrg)
+		organization = os.Getenv(GithubOrg)
+	}
+	if organization == "" {
+		organization = cfg.Tfa.GitHub.Organization
 		if organization == "" {
 			cmdFlags.Usage()
 			return 1
 		}
 	}
 
+	github.Ui.Info(fmt.Sprintf("---------- Finding members of %s on Github without TFA: ----------", organization))
+	accounts, err := github.FindAccountsWithoutTFA(organization, apiKey, outside, repos)
+	if err != nil {
+		github.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	if enforce {
+		enforcement.Organization = organization
+		enforcement.Grace = time.Duration(graceDays) * 24 * time.Hour
+		if !github.enforce(enforcement, accounts, apiKey) {
+			return 1
+		}
+	}
+
+	if len(accounts) == 0 {
+		github.Ui.Info("OK: All members have TFA enabled")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{"Login", "Type", "Profile"}
+	if repos {
+		header = append(header, "Admin", "Write", "Read")
+	}
+	table.SetHeader(header)
+	table.SetRowLine(repos)
+	for _, account := range accounts {
+		accountType := "Member"
+		if account.Outside {
+			accountType = "Outside collaborator"
+		}
 
+		row := []string{account.Login, accountType, account.HTMLURL}
+		if repos {
+			for _, permission := range []string{"admin", "write", "read"} {
+				row = append(row, strings.Join(account.Repositories[permission], "\n"))
+			}
+		}
+		table.Append(row)
+	}
+	table.Render()
+	github.Ui.Warn(fmt.Sprintf("WARNING: %d accounts without TFA", len(accounts)))
 	return 0
 }
 
+// enforce prints the actions as they are planned (or performed), returns false if any of them failed
+func (github *GitHub) enforce(enforcement Enforcement, accounts []Account, apiKey string) bool {
+	actions, err := github.Enforce(enforcement, accounts, apiKey)
+	prefix := ""
+	if enforcement.DryRun {
+		prefix = "[dry-run] "
+	}
+	for _, action := range actions {
+		github.Ui.Info(prefix + action.String())
+	}
+	if err != nil {
+		github.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return false
+	}
+	return true
+}
+
 func (github *GitHub) Help() string {
 	helpText := `
 		Usage: janitor tfa github --apiKey <key> --organization <org>
@@ -96,6 +473,19 @@ func (github *GitHub) Help() string {
 		Options:
 		  --apiKey  the key with permissions to get the info from github (can also be set using the GITHUB_KEY env variable)
 		  --organization the organization we aim to get the info from (can also be set using the GITHUB_ORG env variable)
+		  --baseUrl the base url of the api, e.g. for Github Enterprise (defaults to https://api.github.com/)
+		  --outside also include outside collaborators without TFA
+		  --repos   list the repositories each account can access by permission (admin/write/read),
+		            the accounts with the most access are listed first
+		  --enforce notify accounts without TFA the first time they are seen and remove them from the
+		            organization once the grace period after the notification has expired
+		  --dry-run only print what --enforce would do (defaults to true, use --dry-run=false to act,
+		            which requires --issue-repo)
+		  --grace-days the days from an account is notified until it's removed (defaults to 14)
+		  --state   the file keeping track of when accounts were first seen (defaults to .janitor-tfa-state.json)
+		  --issue-repo the repo (owner/repo) to open an issue in mentioning the accounts that are notified
+		  --cfg     the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml),
+		            used for the options that aren't given as flags or env variables
 		`
 
 	return strings.TrimSpace(helpText)
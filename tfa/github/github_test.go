@@ -1,10 +1,19 @@
 package github_test
 
 import (
+	"fmt"
+	"github.com/freddd/janitor/tfa/github"
+	"github.com/mitchellh/cli"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"testing"
+	"net/http"
+	"net/http/httptest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"testing"
+	"time"
 )
 
 func TestGithub(t *testing.T) {
@@ -24,6 +33,287 @@ var _ = Describe("GithubSuite", func() {
 	})
 })
 
+var _ = Describe("Members without TFA", func() {
+	var server *httptest.Server
+	var requests int
+
+	BeforeEach(func() {
+		requests = 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/orgs/acme/members", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("Authorization") != "token secret" || r.URL.Query().Get("filter") != "2fa_disabled" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message":"Bad credentials"}`)
+				return
+			}
+
+			switch r.URL.Query().Get("page") {
+			case "":
+				w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/acme/members?filter=2fa_disabled&page=2>; rel="next", <%s/orgs/acme/members?filter=2fa_disabled&page=2>; rel="last"`, server.URL, server.URL))
+				fmt.Fprint(w, `[{"login":"alice","html_url":"https://github.com/alice"}]`)
+			case "2":
+				// The first request for the second page hits the rate limit
+				if requests == 2 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `{"message":"You have exceeded a secondary rate limit"}`)
+					return
+				}
+				fmt.Fprint(w, `[{"login":"bob","html_url":"https://github.com/bob"}]`)
+			}
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("follows the pagination and waits for the rate limit", func() {
+		gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		members, err := gh.FindAllUsersWithoutTFA("acme", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(HaveLen(2))
+		Expect(members[0].Login).To(Equal("alice"))
+		Expect(members[1].Login).To(Equal("bob"))
+		Expect(members[1].HTMLURL).To(Equal("https://github.com/bob"))
+		Expect(requests).To(Equal(3))
+	})
+
+	It("returns an error instead of continuing on a non-200", func() {
+		gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := gh.FindAllUsersWithoutTFA("acme", "wrong")
+		Expect(err).To(MatchError("got status code 401 from Github: Bad credentials"))
+	})
+})
+
+var _ = Describe("Exposure of accounts without TFA", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/orgs/acme/members", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"login":"alice"},{"login":"bob"}]`)
+		})
+		mux.HandleFunc("/orgs/acme/outside_collaborators", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("filter") != "2fa_disabled" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `[{"login":"carol"}]`)
+		})
+		mux.HandleFunc("/orgs/acme/repos", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"full_name":"acme/api"},{"full_name":"acme/web"}]`)
+		})
+		mux.HandleFunc("/repos/acme/api/collaborators", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[
+				{"login":"alice","permissions":{"pull":true}},
+				{"login":"carol","permissions":{"admin":true,"push":true,"pull":true}},
+				{"login":"dave","permissions":{"admin":true,"push":true,"pull":true}}
+			]`)
+		})
+		mux.HandleFunc("/repos/acme/web/collaborators", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[
+				{"login":"bob","permissions":{"maintain":true,"pull":true}},
+				{"login":"carol","permissions":{"triage":true,"pull":true}}
+			]`)
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("only lists members unless asked for outside collaborators", func() {
+		gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		accounts, err := gh.FindAccountsWithoutTFA("acme", "secret", false, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(accounts).To(HaveLen(2))
+		Expect(accounts[0].Repositories).To(BeNil())
+	})
+
+	It("lists the repositories by permission with the most exposed accounts first", func() {
+		gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		accounts, err := gh.FindAccountsWithoutTFA("acme", "secret", true, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(accounts).To(HaveLen(3))
+
+		Expect(accounts[0].Login).To(Equal("carol"))
+		Expect(accounts[0].Outside).To(BeTrue())
+		Expect(accounts[0].Repositories["admin"]).To(Equal([]string{"acme/api"}))
+		Expect(accounts[0].Repositories["read"]).To(Equal([]string{"acme/web"}))
+
+		Expect(accounts[1].Login).To(Equal("bob"))
+		Expect(accounts[1].Repositories["write"]).To(Equal([]string{"acme/web"}))
+
+		Expect(accounts[2].Login).To(Equal("alice"))
+		Expect(accounts[2].Outside).To(BeFalse())
+		Expect(accounts[2].Repositories["read"]).To(Equal([]string{"acme/api"}))
+	})
+})
+
+var _ = Describe("Enforcement", func() {
+	day := 24 * time.Hour
+	now := time.Date(2018, 3, 20, 12, 0, 0, 0, time.UTC)
+	alice := github.Account{Member: github.Member{Login: "alice"}}
+	carol := github.Account{Member: github.Member{Login: "carol"}, Outside: true}
+
+	notifiedAt := func(t time.Time) *time.Time {
+		return &t
+	}
+
+	It("plans by the grace period and forgets accounts that enabled TFA", func() {
+		state := &github.State{Offenders: map[string]*github.Offender{
+			"carol": {FirstSeen: now.Add(-20 * day), NotifiedAt: notifiedAt(now.Add(-20 * day))},
+			"bob":   {FirstSeen: now.Add(-2 * day), NotifiedAt: notifiedAt(now.Add(-2 * day))},
+		}}
+
+		actions := github.Plan([]github.Account{alice, carol}, state, now, 14*day)
+		Expect(actions).To(HaveLen(2))
+		Expect(actions[0].Account.Login).To(Equal("carol"))
+		Expect(actions[0].Kind).To(Equal(github.Remove))
+		Expect(actions[1].Account.Login).To(Equal("alice"))
+		Expect(actions[1].Kind).To(Equal(github.Notify))
+		Expect(actions[1].Deadline).To(Equal(now.Add(14 * day)))
+
+		Expect(state.Offenders).To(HaveKey("alice"))
+		Expect(state.Offenders).NotTo(HaveKey("bob"))
+
+		state.Offenders["alice"].NotifiedAt = notifiedAt(now)
+		actions = github.Plan([]github.Account{alice}, state, now.Add(day), 14*day)
+		Expect(actions[0].Kind).To(Equal(github.Wait))
+	})
+
+	It("notifies before removing even without a grace period", func() {
+		state := &github.State{Offenders: map[string]*github.Offender{}}
+		actions := github.Plan([]github.Account{alice}, state, now, 0)
+		Expect(actions[0].Kind).To(Equal(github.Notify))
+
+		state.Offenders["alice"].NotifiedAt = notifiedAt(now)
+		actions = github.Plan([]github.Account{alice}, state, now, 0)
+		Expect(actions[0].Kind).To(Equal(github.Remove))
+	})
+
+	It("starts the grace period with the notification", func() {
+		// first seen long ago, by a run that couldn't notify or with a longer grace period
+		state := &github.State{Offenders: map[string]*github.Offender{
+			"alice": {FirstSeen: now.Add(-60 * day)},
+			"carol": {FirstSeen: now.Add(-60 * day), NotifiedAt: notifiedAt(now.Add(-3 * day))},
+		}}
+		actions := github.Plan([]github.Account{alice, carol}, state, now, 7*day)
+		Expect(actions[0].Account.Login).To(Equal("carol"))
+		Expect(actions[0].Kind).To(Equal(github.Wait))
+		Expect(actions[0].Deadline).To(Equal(now.Add(4 * day)))
+		Expect(actions[1].Kind).To(Equal(github.Notify))
+		Expect(actions[1].Deadline).To(Equal(now.Add(7 * day)))
+	})
+
+	Context("against the api", func() {
+		var server *httptest.Server
+		var dir string
+		var calls []string
+
+		BeforeEach(func() {
+			calls = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				switch r.Method {
+				case "POST":
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{"number":1}`)
+				case "DELETE":
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+
+			var err error
+			dir, err = ioutil.TempDir("", "janitor-tfa")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			os.RemoveAll(dir)
+		})
+
+		enforcement := func(dryRun bool) github.Enforcement {
+			return github.Enforcement{
+				Organization: "acme",
+				IssueRepo:    "acme/security",
+				Grace:        14 * day,
+				StateFile:    filepath.Join(dir, "state.json"),
+				DryRun:       dryRun,
+			}
+		}
+
+		It("doesn't call the api or write the state on a dry run", func() {
+			gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+			actions, err := gh.Enforce(enforcement(true), []github.Account{alice}, "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions).To(HaveLen(1))
+			Expect(calls).To(BeEmpty())
+			Expect(filepath.Join(dir, "state.json")).NotTo(BeAnExistingFile())
+		})
+
+		It("requires an issue repo to notify in unless it's a dry run", func() {
+			gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+			withoutRepo := enforcement(false)
+			withoutRepo.IssueRepo = ""
+			_, err := gh.Enforce(withoutRepo, []github.Account{alice}, "secret")
+			Expect(err).To(MatchError(ContainSubstring("requires an issue repo")))
+			Expect(calls).To(BeEmpty())
+			Expect(filepath.Join(dir, "state.json")).NotTo(BeAnExistingFile())
+
+			withoutRepo.DryRun = true
+			actions, err := gh.Enforce(withoutRepo, []github.Account{alice}, "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actions[0].Kind).To(Equal(github.Notify))
+		})
+
+		It("doesn't mark accounts notified when the issue can't be created", func() {
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message":"Not Found"}`)
+			}))
+			defer failing.Close()
+
+			gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: failing.URL}
+			_, err := gh.Enforce(enforcement(false), []github.Account{alice}, "secret")
+			Expect(err).To(HaveOccurred())
+			// nothing is saved, alice is notified again on the next run
+			Expect(filepath.Join(dir, "state.json")).NotTo(BeAnExistingFile())
+		})
+
+		It("notifies new accounts and removes the ones past the grace period", func() {
+			state := &github.State{Offenders: map[string]*github.Offender{
+				"carol": {FirstSeen: time.Now().Add(-15 * day), NotifiedAt: notifiedAt(time.Now().Add(-15 * day))},
+			}}
+			Expect(github.WriteState(filepath.Join(dir, "state.json"), state)).To(Succeed())
+
+			gh := &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+			_, err := gh.Enforce(enforcement(false), []github.Account{alice, carol}, "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(Equal([]string{
+				"DELETE /orgs/acme/outside_collaborators/carol",
+				"POST /repos/acme/security/issues",
+			}))
+
+			state, err = github.ReadState(filepath.Join(dir, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Offenders).To(HaveLen(1))
+			Expect(state.Offenders["alice"].NotifiedAt).NotTo(BeNil())
+
+			// Already notified, nothing to do until the grace period expires
+			calls = nil
+			_, err = gh.Enforce(enforcement(false), []github.Account{alice}, "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls).To(BeEmpty())
+		})
+	})
+})
+
 func clearField(field reflect.Value) {
 	if !field.CanAddr() {
 		return
@@ -0,0 +1,198 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"github.com/parnurzeal/gorequest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultBaseUrl = "https://gitlab.com/"
+	GitlabToken    = "GITLAB_TOKEN"
+	GitlabUrl      = "GITLAB_URL"
+	usersPath      = "api/v4/users?active=true&without_project_bots=true&per_page=100"
+	tfaFilter      = "&two_factor=disabled"
+)
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// User is only returned with the email, admin flag and two_factor_enabled when the token belongs to an admin
+type User struct {
+	ID               int    `json:"id"`
+	Username         string `json:"username"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	IsAdmin          bool   `json:"is_admin"`
+	WebURL           string `json:"web_url"`
+	TwoFactorEnabled *bool  `json:"two_factor_enabled"`
+}
+
+type Gitlab struct {
+	Ui cli.Ui
+	// BaseUrl of the instance, defaults to DefaultBaseUrl
+	BaseUrl string
+}
+
+// FindAllUsersWithoutTFA lists the active users without TFA, filtering on two_factor requires an admin
+// token, i.e. a self-managed instance. Any other token gets every user, so the users are filtered again on
+// two_factor_enabled and it's an error if it isn't visible, everyone would look like they are without TFA
+// https://docs.gitlab.com/ee/api/users.html#for-administrators
+func (gitlab *Gitlab) FindAllUsersWithoutTFA(token string) ([]User, error) {
+	all, err := gitlab.findUsers(gitlab.baseUrl()+usersPath+tfaFilter, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	for _, user := range all {
+		if user.TwoFactorEnabled == nil {
+			return nil, fmt.Errorf("two_factor_enabled of %s isn't visible, the token has to belong to an admin", user.Username)
+		}
+		if !*user.TwoFactorEnabled {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// FindAllUsers finds every active user, with or without TFA
+func (gitlab *Gitlab) FindAllUsers(token string) ([]User, error) {
+	return gitlab.findUsers(gitlab.baseUrl()+usersPath, token)
+}
+
+func (gitlab *Gitlab) findUsers(targetUrl string, token string) ([]User, error) {
+	var users []User
+	for targetUrl != "" {
+		res, body, errs := gorequest.New().
+			Get(targetUrl).
+			Set("PRIVATE-TOKEN", token).
+			End()
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		if res.StatusCode != 200 {
+			return nil, fmt.Errorf("got status code %d from Gitlab: %s", res.StatusCode, errorMessage(body))
+		}
+
+		var page []User
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			return nil, err
+		}
+		users = append(users, page...)
+
+		targetUrl = ""
+		if match := nextLink.FindStringSubmatch(res.Header.Get("Link")); match != nil {
+			targetUrl = match[1]
+		}
+	}
+	return users, nil
+}
+
+func errorMessage(body string) string {
+	response := struct {
+		Message interface{} `json:"message"`
+		Error   string      `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return strings.TrimSpace(body)
+	}
+	if response.Message != nil {
+		return fmt.Sprint(response.Message)
+	}
+	if response.Error != "" {
+		return response.Error
+	}
+	return strings.TrimSpace(body)
+}
+
+func (gitlab *Gitlab) baseUrl() string {
+	if gitlab.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	if !strings.HasSuffix(gitlab.BaseUrl, "/") {
+		return gitlab.BaseUrl + "/"
+	}
+	return gitlab.BaseUrl
+}
+
+func (gitlab *Gitlab) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("gitlab", flag.ExitOnError)
+	cmdFlags.Usage = func() { gitlab.Ui.Output(gitlab.Help()) }
+	token := ""
+	cmdFlags.StringVar(&token, "token", "", "The admin token")
+	cmdFlags.StringVar(&gitlab.BaseUrl, "baseUrl", os.Getenv(GitlabUrl), "The url of the instance")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		gitlab.Ui.Error(err.Error())
+		return 1
+	}
+	if gitlab.BaseUrl == "" {
+		gitlab.BaseUrl = cfg.Tfa.Gitlab.BaseUrl
+	}
+
+	if token == "" {
+		token = os.Getenv(GitlabToken)
+	}
+	if token == "" {
+		token = cfg.Tfa.Gitlab.Token
+		if token == "" {
+			cmdFlags.Usage()
+			return 1
+		}
+	}
+
+	gitlab.Ui.Info(fmt.Sprintf("---------- Finding users on %s without TFA: ----------", gitlab.baseUrl()))
+	users, err := gitlab.FindAllUsersWithoutTFA(token)
+	if err != nil {
+		gitlab.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	if len(users) == 0 {
+		gitlab.Ui.Info("OK: All users have TFA enabled")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Username", "Name", "Email", "Admin", "Profile"})
+	for _, user := range users {
+		table.Append([]string{user.Username, user.Name, user.Email, strconv.FormatBool(user.IsAdmin), user.WebURL})
+	}
+	table.Render()
+	gitlab.Ui.Warn(fmt.Sprintf("WARNING: %d users without TFA", len(users)))
+	return 0
+}
+
+func (gitlab *Gitlab) Help() string {
+	helpText := `
+		Usage: janitor tfa gitlab --token <token>
+		  Gets the current status of TFA usage on a self-managed gitlab instance using an admin token
+		Options:
+		  --token   a personal access token of an admin with the read_api scope (can also be set using the GITLAB_TOKEN env variable)
+		  --baseUrl the url of the instance (can also be set using the GITLAB_URL env variable, defaults to https://gitlab.com/)
+		  --cfg     the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml),
+		            used for the options that aren't given as flags or env variables
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (gitlab *Gitlab) Synopsis() string {
+	return "Check TFA status in gitlab"
+}
@@ -0,0 +1,73 @@
+package gitlab_test
+
+import (
+	"fmt"
+	"github.com/freddd/janitor/tfa/gitlab"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitlab(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GitlabSuite")
+}
+
+var _ = Describe("Users without TFA", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("PRIVATE-TOKEN") == "user" {
+				// the filter is ignored and the admin only fields are left out for non-admins
+				fmt.Fprint(w, `[{"id":1,"username":"alice"},{"id":2,"username":"bob"}]`)
+				return
+			}
+			if r.URL.Path != "/api/v4/users" || r.Header.Get("PRIVATE-TOKEN") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message":"401 Unauthorized"}`)
+				return
+			}
+			if r.URL.Query().Get("two_factor") != "disabled" || r.URL.Query().Get("active") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			switch r.URL.Query().Get("page") {
+			case "":
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v4/users?two_factor=disabled&active=true&page=2>; rel="next"`, server.URL))
+				fmt.Fprint(w, `[{"id":1,"username":"alice","email":"alice@example.com","is_admin":true,"two_factor_enabled":false}]`)
+			case "2":
+				fmt.Fprint(w, `[{"id":2,"username":"bob","email":"bob@example.com","two_factor_enabled":false},{"id":3,"username":"carol","two_factor_enabled":true}]`)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("follows the pagination", func() {
+		g := &gitlab.Gitlab{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		users, err := g.FindAllUsersWithoutTFA("secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveLen(2))
+		Expect(users[0].IsAdmin).To(BeTrue())
+		Expect(users[1].Username).To(Equal("bob"))
+	})
+
+	It("fails instead of reporting everyone when the token isn't an admin's", func() {
+		g := &gitlab.Gitlab{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := g.FindAllUsersWithoutTFA("user")
+		Expect(err).To(MatchError("two_factor_enabled of alice isn't visible, the token has to belong to an admin"))
+	})
+
+	It("returns the error message of the api", func() {
+		g := &gitlab.Gitlab{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := g.FindAllUsersWithoutTFA("wrong")
+		Expect(err).To(MatchError("got status code 401 from Gitlab: 401 Unauthorized"))
+	})
+})
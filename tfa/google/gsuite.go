@@ -1,29 +1,245 @@
 package google
 
 import (
-	"strings"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
 	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"github.com/parnurzeal/gorequest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultBaseUrl = "https://admin.googleapis.com/"
+	usersPath      = "admin/directory/v1/users"
+	GsuiteKey      = "GSUITE_KEY"
+	GsuiteSubject  = "GSUITE_SUBJECT"
+	maxResults     = 500
 )
 
-const gsuiteKey string = "GSUITE_KEY"
+type User struct {
+	ID           string `json:"id"`
+	PrimaryEmail string `json:"primaryEmail"`
+	Name         struct {
+		FullName string `json:"fullName"`
+	} `json:"name"`
+	IsAdmin          bool   `json:"isAdmin"`
+	IsDelegatedAdmin bool   `json:"isDelegatedAdmin"`
+	IsEnrolledIn2Sv  bool   `json:"isEnrolledIn2Sv"`
+	IsEnforcedIn2Sv  bool   `json:"isEnforcedIn2Sv"`
+	Suspended        bool   `json:"suspended"`
+	OrgUnitPath      string `json:"orgUnitPath"`
+}
+
+// Role is super admin or admin (delegated), empty for a regular user
+func (user User) Role() string {
+	switch {
+	case user.IsAdmin:
+		return "super admin"
+	case user.IsDelegatedAdmin:
+		return "admin"
+	}
+	return ""
+}
+
+type UsersResponse struct {
+	Users         []User `json:"users"`
+	NextPageToken string `json:"nextPageToken"`
+}
 
 type Gsuite struct {
 	Ui cli.Ui
+	// BaseUrl of the Admin SDK, defaults to DefaultBaseUrl
+	BaseUrl string
+}
+
+// FindAllUsersWithoutTFA lists the active users that aren't enrolled in 2-step verification, limited to
+// the users in orgUnit (and below) unless it's empty
+func (g *Gsuite) FindAllUsersWithoutTFA(token string, orgUnit string) ([]User, error) {
+	all, err := g.FindAllUsers(token, orgUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	for _, user := range all {
+		if !user.IsEnrolledIn2Sv {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// FindAllUsers lists the active users, with or without 2-step verification
+// https://developers.google.com/admin-sdk/directory/reference/rest/v1/users/list
+func (g *Gsuite) FindAllUsers(token string, orgUnit string) ([]User, error) {
+	query := url.Values{
+		"customer":   {"my_customer"},
+		"maxResults": {strconv.Itoa(maxResults)},
+		"orderBy":    {"email"},
+	}
+	if orgUnit != "" {
+		query.Set("query", fmt.Sprintf("orgUnitPath='%s'", orgUnit))
+	}
+
+	var users []User
+	for {
+		res, body, errs := gorequest.New().
+			Get(g.baseUrl()+usersPath+"?"+query.Encode()).
+			Set("Authorization", fmt.Sprintf("Bearer %s", token)).
+			End()
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		if res.StatusCode != 200 {
+			return nil, fmt.Errorf("got status code %d from Google: %s", res.StatusCode, errorMessage(body))
+		}
+
+		response := UsersResponse{}
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			return nil, err
+		}
+		for _, user := range response.Users {
+			if !user.Suspended {
+				users = append(users, user)
+			}
+		}
+
+		if response.NextPageToken == "" {
+			return users, nil
+		}
+		query.Set("pageToken", response.NextPageToken)
+	}
+}
+
+func errorMessage(body string) string {
+	response := struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || response.Error.Message == "" {
+		return strings.TrimSpace(body)
+	}
+	return response.Error.Message
+}
+
+func (g *Gsuite) baseUrl() string {
+	if g.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	if !strings.HasSuffix(g.BaseUrl, "/") {
+		return g.BaseUrl + "/"
+	}
+	return g.BaseUrl
 }
 
 func (g *Gsuite) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("gsuite", flag.ExitOnError)
+	cmdFlags.Usage = func() { g.Ui.Output(g.Help()) }
+	apiKey := ""
+	subject := ""
+	orgUnit := ""
+	cmdFlags.StringVar(&apiKey, "apiKey", "", "The json key of the service account")
+	cmdFlags.StringVar(&subject, "subject", "", "The admin the service account acts as")
+	cmdFlags.StringVar(&orgUnit, "orgUnit", "", "Only check the users in the org unit")
+	cmdFlags.StringVar(&g.BaseUrl, "baseUrl", DefaultBaseUrl, "The base url of the api")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		g.Ui.Error(err.Error())
+		return 1
+	}
+	set := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["baseUrl"] && cfg.Tfa.Gsuite.BaseUrl != "" {
+		g.BaseUrl = cfg.Tfa.Gsuite.BaseUrl
+	}
+	if orgUnit == "" {
+		orgUnit = cfg.Tfa.Gsuite.OrgUnit
+	}
+
+	if apiKey == "" {
+		apiKey = os.Getenv(GsuiteKey)
+	}
+	if apiKey == "" {
+		apiKey = cfg.Tfa.Gsuite.KeyFile
+		if apiKey == "" {
+			cmdFlags.Usage()
+			return 1
+		}
+	}
+
+	if subject == "" {
+		subject = os.Getenv(GsuiteSubject)
+	}
+	if subject == "" {
+		subject = cfg.Tfa.Gsuite.Subject
+		if subject == "" {
+			cmdFlags.Usage()
+			return 1
+		}
+	}
+
 	g.Ui.Info("---------- Finding users in GSuite without TFA: ----------")
-	g.Ui.Error("Not yet implemented!")
-	g.Ui.Info("----------------------------------------------------------")
+	account, err := ReadServiceAccount(apiKey)
+	if err != nil {
+		g.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	token, err := account.Token(subject, DirectoryScope)
+	if err != nil {
+		g.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	users, err := g.FindAllUsersWithoutTFA(token, orgUnit)
+	if err != nil {
+		g.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	if len(users) == 0 {
+		g.Ui.Info("OK: All users have TFA enabled")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Email", "Name", "Org unit", "Role", "Enforced"})
+	for _, user := range users {
+		table.Append([]string{user.PrimaryEmail, user.Name.FullName, user.OrgUnitPath,
+			user.Role(), strconv.FormatBool(user.IsEnforcedIn2Sv)})
+	}
+	table.Render()
+	g.Ui.Warn(fmt.Sprintf("WARNING: %d users without TFA", len(users)))
 	return 0
 }
 
 func (g *Gsuite) Help() string {
 	helpText := `
-		Usage: janitor tfa gsuite
-		  Gets the current status of TFA usage on github/gsuite
+		Usage: janitor tfa gsuite --apiKey <key.json> --subject <admin@example.com>
+		  Gets the current status of TFA usage in gsuite using a service account with domain-wide delegation
+		  of the https://www.googleapis.com/auth/admin.directory.user.readonly scope
 		Options:
-		  --apiKey  the key with permissions to get the info from github (can also be set using the GSUITE_KEY env variable)
+		  --apiKey  the path to the json key of the service account (can also be set using the GSUITE_KEY env variable)
+		  --subject the email of an admin the service account acts as (can also be set using the GSUITE_SUBJECT env variable)
+		  --orgUnit only check the users in the org unit (and below), e.g. /Engineering
+		  --baseUrl the base url of the Admin SDK (defaults to https://admin.googleapis.com/)
+		  --cfg     the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml),
+		            used for the options that aren't given as flags or env variables
 		`
 
 	return strings.TrimSpace(helpText)
@@ -31,4 +247,4 @@ func (g *Gsuite) Help() string {
 
 func (g *Gsuite) Synopsis() string {
 	return "Check TFA status in gsuite"
-}
\ No newline at end of file
+}
@@ -0,0 +1,161 @@
+package google_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/freddd/janitor/tfa/google"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGsuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GsuiteSuite")
+}
+
+var _ = Describe("Users without TFA", func() {
+	var server *httptest.Server
+	var key *rsa.PrivateKey
+	var dir string
+
+	// verifyAssertion checks the signature and returns the claims of the jwt
+	verifyAssertion := func(assertion string) map[string]interface{} {
+		parts := strings.Split(assertion, ".")
+		if len(parts) != 3 {
+			return nil
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil
+		}
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature) != nil {
+			return nil
+		}
+
+		content, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil
+		}
+		claims := map[string]interface{}{}
+		json.Unmarshal(content, &claims)
+		return claims
+	}
+
+	BeforeEach(func() {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+			claims := verifyAssertion(r.FormValue("assertion"))
+			if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || claims == nil || claims["sub"] != "admin@example.com" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+		})
+		mux.HandleFunc("/admin/directory/v1/users", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("customer") != "my_customer" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":{"code":401,"message":"Login Required."}}`)
+				return
+			}
+			if r.URL.Query().Get("query") == "orgUnitPath='/Sales'" {
+				fmt.Fprint(w, `{"users":[]}`)
+				return
+			}
+
+			switch r.URL.Query().Get("pageToken") {
+			case "":
+				fmt.Fprint(w, `{"users":[
+					{"primaryEmail":"alice@example.com","isEnrolledIn2Sv":true},
+					{"primaryEmail":"bob@example.com","isAdmin":true,"isEnrolledIn2Sv":false,"orgUnitPath":"/Engineering"}
+				],"nextPageToken":"page2"}`)
+			case "page2":
+				fmt.Fprint(w, `{"users":[
+					{"primaryEmail":"carol@example.com","isEnrolledIn2Sv":false,"isEnforcedIn2Sv":true},
+					{"primaryEmail":"dave@example.com","isEnrolledIn2Sv":false,"suspended":true}
+				]}`)
+			}
+		})
+		server = httptest.NewServer(mux)
+
+		dir, err = ioutil.TempDir("", "janitor-gsuite")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	writeKey := func() string {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		content, err := json.Marshal(map[string]string{
+			"type":         "service_account",
+			"client_email": "janitor@project.iam.gserviceaccount.com",
+			"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			"token_uri":    server.URL + "/token",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		path := filepath.Join(dir, "key.json")
+		Expect(ioutil.WriteFile(path, content, 0600)).To(Succeed())
+		return path
+	}
+
+	It("gets a token with a signed jwt for the subject", func() {
+		account, err := google.ReadServiceAccount(writeKey())
+		Expect(err).NotTo(HaveOccurred())
+
+		token, err := account.Token("admin@example.com", "scope")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("token"))
+
+		_, err = account.Token("someone@example.com", "scope")
+		Expect(err).To(MatchError("got status code 400 from Google: invalid_grant Invalid JWT Signature."))
+	})
+
+	It("lists the active users that aren't enrolled across all pages", func() {
+		g := &google.Gsuite{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		users, err := g.FindAllUsersWithoutTFA("token", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveLen(2))
+		Expect(users[0].PrimaryEmail).To(Equal("bob@example.com"))
+		Expect(users[0].IsAdmin).To(BeTrue())
+		Expect(users[1].PrimaryEmail).To(Equal("carol@example.com"))
+		Expect(users[1].IsEnforcedIn2Sv).To(BeTrue())
+	})
+
+	It("filters by org unit", func() {
+		g := &google.Gsuite{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		users, err := g.FindAllUsersWithoutTFA("token", "/Sales")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(BeEmpty())
+	})
+
+	It("returns the error message of the api", func() {
+		g := &google.Gsuite{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := g.FindAllUsersWithoutTFA("wrong", "")
+		Expect(err).To(MatchError("got status code 401 from Google: Login Required."))
+	})
+})
@@ -0,0 +1,137 @@
+package google
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/parnurzeal/gorequest"
+	"io/ioutil"
+	"net/url"
+	"time"
+)
+
+const (
+	DirectoryScope  = "https://www.googleapis.com/auth/admin.directory.user.readonly"
+	defaultTokenUri = "https://oauth2.googleapis.com/token"
+	jwtBearerGrant  = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	tokenLifetime   = time.Hour
+)
+
+// ServiceAccount is the part of the json key of a service account that is needed to get a token
+type ServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenUri     string `json:"token_uri"`
+}
+
+func ReadServiceAccount(path string) (*ServiceAccount, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &ServiceAccount{}
+	if err := json.Unmarshal(content, account); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("%s: not a service account key, client_email and private_key are required", path)
+	}
+	if account.TokenUri == "" {
+		account.TokenUri = defaultTokenUri
+	}
+	return account, nil
+}
+
+// Token exchanges a signed jwt for an access token acting as subject, which requires the service account
+// to have domain-wide delegation for the scope
+// https://developers.google.com/identity/protocols/oauth2/service-account#authorizingrequests
+func (account *ServiceAccount) Token(subject string, scope string) (string, error) {
+	assertion, err := account.assertion(subject, scope, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{"grant_type": {jwtBearerGrant}, "assertion": {assertion}}
+	res, body, errs := gorequest.New().
+		Post(account.TokenUri).
+		Type("form").
+		SendString(form.Encode()).
+		End()
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+
+	response := struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return "", fmt.Errorf("got status code %d from Google: %s", res.StatusCode, body)
+	}
+	if res.StatusCode != 200 || response.AccessToken == "" {
+		return "", fmt.Errorf("got status code %d from Google: %s %s", res.StatusCode, response.Error, response.ErrorDescription)
+	}
+	return response.AccessToken, nil
+}
+
+func (account *ServiceAccount) assertion(subject string, scope string, now time.Time) (string, error) {
+	key, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": account.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"sub":   subject,
+		"scope": scope,
+		"aud":   account.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey accepts both PKCS#8 (what Google hands out) and PKCS#1 keys
+func parsePrivateKey(content string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(content))
+	if block == nil {
+		return nil, errors.New("private_key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private_key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,289 @@
+package tfa
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultHistoryFile = ".janitor-tfa-history.jsonl"
+
+// Run is a line in the history file
+type Run struct {
+	Time time.Time `json:"time"`
+	// Providers are the ones that succeeded, the others aren't part of the diff
+	Providers []string  `json:"providers"`
+	Accounts  []Account `json:"accounts"`
+	// Members are the logins of every user per provider, for the providers that expose them
+	Members map[string][]string `json:"members,omitempty"`
+}
+
+// Count returns the number of accounts without 2FA in the provider
+func (run Run) Count(provider string) int {
+	count := 0
+	for _, account := range run.Accounts {
+		if account.Provider == provider {
+			count++
+		}
+	}
+	return count
+}
+
+// Diff between two runs, only for the providers that succeeded in both
+type Diff struct {
+	// Joined are the new users without 2FA
+	Joined []Account
+	// Disabled are the users that had 2FA in the previous run
+	Disabled []Account
+	Fixed    []Account
+	// Left are the users without 2FA that are gone
+	Left []Account
+}
+
+// AppendRun adds the run as a json line to the history file
+func AppendRun(path string, run Run) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadRuns returns the runs in the order they were appended, a missing file has no runs
+func ReadRuns(path string) ([]Run, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var runs []Run
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			run := Run{}
+			if err := json.Unmarshal(line, &run); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", path, lineNumber, err)
+			}
+			runs = append(runs, run)
+		}
+		if err == io.EOF {
+			return runs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// DiffRuns compares the accounts without 2FA. Without the members of a provider an account that is new
+// to the list is counted as disabled and one that is gone as fixed
+func DiffRuns(previous Run, current Run) Diff {
+	diff := Diff{}
+	both := map[string]bool{}
+	for _, provider := range previous.Providers {
+		if containsString(current.Providers, provider) {
+			both[provider] = true
+		}
+	}
+
+	before := accountKeys(previous.Accounts)
+	after := accountKeys(current.Accounts)
+
+	for _, account := range current.Accounts {
+		if !both[account.Provider] || before[accountKey(account)] {
+			continue
+		}
+		if members, ok := previous.Members[account.Provider]; ok && !containsString(members, account.Login) {
+			diff.Joined = append(diff.Joined, account)
+		} else {
+			diff.Disabled = append(diff.Disabled, account)
+		}
+	}
+
+	for _, account := range previous.Accounts {
+		if !both[account.Provider] || after[accountKey(account)] {
+			continue
+		}
+		if members, ok := current.Members[account.Provider]; ok && !containsString(members, account.Login) {
+			diff.Left = append(diff.Left, account)
+		} else {
+			diff.Fixed = append(diff.Fixed, account)
+		}
+	}
+	return diff
+}
+
+func accountKey(account Account) string {
+	return account.Provider + ":" + account.Login
+}
+
+func accountKeys(accounts []Account) map[string]bool {
+	keys := map[string]bool{}
+	for _, account := range accounts {
+		keys[accountKey(account)] = true
+	}
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type History struct {
+	Ui cli.Ui
+	// Out receives the tables, defaults to stdout
+	Out io.Writer
+}
+
+func (history *History) out() io.Writer {
+	if history.Out == nil {
+		return os.Stdout
+	}
+	return history.Out
+}
+
+func (history *History) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("history", flag.ExitOnError)
+	cmdFlags.Usage = func() { history.Ui.Output(history.Help()) }
+	path := DefaultHistoryFile
+	last := 10
+	cmdFlags.StringVar(&path, "file", path, "The history file")
+	cmdFlags.IntVar(&last, "last", last, "How many runs to show")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		history.Ui.Error(err.Error())
+		return 1
+	}
+	set := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["file"] && cfg.Tfa.HistoryFile != "" {
+		path = cfg.Tfa.HistoryFile
+	}
+
+	runs, err := ReadRuns(path)
+	if err != nil {
+		history.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+	if len(runs) == 0 {
+		history.Ui.Error(fmt.Sprintf("No runs in %s, they are recorded by janitor tfa all", path))
+		return 1
+	}
+
+	history.Ui.Info("---------- Users without TFA over time: ----------")
+	shown := runs
+	if last > 0 && len(shown) > last {
+		shown = shown[len(shown)-last:]
+	}
+	history.counts(shown)
+
+	if len(runs) < 2 {
+		return 0
+	}
+
+	previous, current := runs[len(runs)-2], runs[len(runs)-1]
+	history.Ui.Info(fmt.Sprintf("---------- Changes since %s: ----------", previous.Time.Format(time.RFC3339)))
+	diff := DiffRuns(previous, current)
+	table := tablewriter.NewWriter(history.out())
+	table.SetHeader([]string{"Change", "Provider", "Login", "Name", "Email"})
+	for _, change := range []struct {
+		name     string
+		accounts []Account
+	}{
+		{"disabled TFA", diff.Disabled},
+		{"joined without TFA", diff.Joined},
+		{"fixed", diff.Fixed},
+		{"left", diff.Left},
+	} {
+		for _, account := range change.accounts {
+			table.Append([]string{change.name, account.Provider, account.Login, account.Name, account.Email})
+		}
+	}
+	table.Render()
+	return 0
+}
+
+// counts prints a row per run with the total and a column per provider, - if it didn't run (or failed)
+func (history *History) counts(runs []Run) {
+	var providers []string
+	for _, run := range runs {
+		for _, provider := range run.Providers {
+			if !containsString(providers, provider) {
+				providers = append(providers, provider)
+			}
+		}
+	}
+	sort.Strings(providers)
+
+	table := tablewriter.NewWriter(history.out())
+	table.SetHeader(append([]string{"Time", "Total"}, providers...))
+	for _, run := range runs {
+		row := []string{run.Time.Format(time.RFC3339), strconv.Itoa(len(run.Accounts))}
+		for _, provider := range providers {
+			if containsString(run.Providers, provider) {
+				row = append(row, strconv.Itoa(run.Count(provider)))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		table.Append(row)
+	}
+	table.Render()
+}
+
+func (history *History) Help() string {
+	helpText := `
+		Usage: janitor tfa history
+		  Shows the number of users without TFA in the runs of janitor tfa all and what changed in the last run:
+		  who disabled TFA, who joined without it, who fixed it and who left. The single provider commands,
+		  e.g. janitor tfa github, aren't recorded
+		Options:
+		  --file the history file (defaults to tfa.historyFile of the config or .janitor-tfa-history.jsonl)
+		  --last how many runs to show (defaults to 10)
+		  --cfg  the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml)
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (history *History) Synopsis() string {
+	return "Show how TFA adoption changes over time"
+}
@@ -0,0 +1,122 @@
+package tfa_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/freddd/janitor/tfa"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fakeMemberProvider struct {
+	fakeProvider
+	members []string
+}
+
+func (p *fakeMemberProvider) Members(ctx context.Context) ([]string, error) {
+	return p.members, nil
+}
+
+var _ = Describe("History", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-tfa-history")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	account := func(provider string, login string) tfa.Account {
+		return tfa.Account{Login: login, Provider: provider}
+	}
+
+	It("diffs the providers that succeeded in both runs", func() {
+		previous := tfa.Run{
+			Providers: []string{"github", "slack", "okta"},
+			Accounts:  []tfa.Account{account("github", "alice"), account("github", "bob"), account("slack", "carol"), account("okta", "erin")},
+			Members:   map[string][]string{"github": {"alice", "bob", "dave"}},
+		}
+		current := tfa.Run{
+			Providers: []string{"github", "slack"},
+			Accounts:  []tfa.Account{account("github", "bob"), account("github", "dave"), account("github", "frank"), account("slack", "gina")},
+			Members:   map[string][]string{"github": {"bob", "dave", "frank"}},
+		}
+
+		diff := tfa.DiffRuns(previous, current)
+		Expect(diff.Disabled).To(Equal([]tfa.Account{account("github", "dave"), account("slack", "gina")}))
+		Expect(diff.Joined).To(Equal([]tfa.Account{account("github", "frank")}))
+		Expect(diff.Left).To(Equal([]tfa.Account{account("github", "alice")}))
+		Expect(diff.Fixed).To(Equal([]tfa.Account{account("slack", "carol")}))
+	})
+
+	It("records the runs of tfa all and shows them", func() {
+		path := filepath.Join(dir, "history.jsonl")
+		github := &fakeMemberProvider{
+			fakeProvider: fakeProvider{name: "github", accounts: []tfa.Account{account("github", "alice")}},
+			members:      []string{"alice", "bob"},
+		}
+		all := &tfa.All{Ui: cli.NewMockUi(), Providers: []tfa.Provider{github}, Out: &bytes.Buffer{}}
+		Expect(all.Run([]string{"-history", path})).To(Equal(0))
+
+		github.accounts = []tfa.Account{account("github", "bob"), account("github", "carol")}
+		github.members = []string{"alice", "bob", "carol"}
+		Expect(all.Run([]string{"-history", path})).To(Equal(0))
+
+		runs, err := tfa.ReadRuns(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[0].Providers).To(Equal([]string{"github"}))
+		Expect(runs[0].Members["github"]).To(Equal([]string{"alice", "bob"}))
+		Expect(runs[1].Time).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(runs[1].Count("github")).To(Equal(2))
+
+		out := &bytes.Buffer{}
+		history := &tfa.History{Ui: cli.NewMockUi(), Out: out}
+		Expect(history.Run([]string{"-file", path})).To(Equal(0))
+		Expect(out.String()).To(MatchRegexp(`disabled TFA\s+\|\s+github\s+\|\s+bob`))
+		Expect(out.String()).To(MatchRegexp(`joined without TFA\s+\|\s+github\s+\|\s+carol`))
+		Expect(out.String()).To(MatchRegexp(`fixed\s+\|\s+github\s+\|\s+alice`))
+	})
+
+	It("uses the history file of the config in tfa all and tfa history", func() {
+		path := filepath.Join(dir, "history.jsonl")
+		cfgPath := filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(cfgPath, []byte("tfa:\n  historyFile: "+path+"\n"), 0600)).To(Succeed())
+
+		github := &fakeProvider{name: "github", accounts: []tfa.Account{account("github", "alice")}}
+		all := &tfa.All{Ui: cli.NewMockUi(), Providers: []tfa.Provider{github}, Out: &bytes.Buffer{}}
+		Expect(all.Run([]string{"-cfg", cfgPath})).To(Equal(0))
+
+		out := &bytes.Buffer{}
+		history := &tfa.History{Ui: cli.NewMockUi(), Out: out}
+		Expect(history.Run([]string{"-cfg", cfgPath})).To(Equal(0))
+		Expect(out.String()).To(MatchRegexp(`\|\s+1\s+\|\s+1\s+\|`))
+	})
+
+	It("doesn't record the providers that failed", func() {
+		path := filepath.Join(dir, "history.jsonl")
+		broken := &fakeProvider{name: "slack", err: context.DeadlineExceeded}
+		all := &tfa.All{Ui: cli.NewMockUi(), Providers: []tfa.Provider{&fakeProvider{name: "github"}, broken}, Out: &bytes.Buffer{}}
+		Expect(all.Run([]string{"-history", path})).To(Equal(1))
+
+		runs, err := tfa.ReadRuns(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runs[0].Providers).To(Equal([]string{"github"}))
+	})
+
+	It("reports the line of a broken run", func() {
+		path := filepath.Join(dir, "history.jsonl")
+		Expect(ioutil.WriteFile(path, []byte("{\"providers\":[\"github\"]}\n{broken\n"), 0600)).To(Succeed())
+		_, err := tfa.ReadRuns(path)
+		Expect(err).To(MatchError(ContainSubstring("history.jsonl:2: ")))
+	})
+})
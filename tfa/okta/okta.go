@@ -0,0 +1,293 @@
+package okta
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"github.com/parnurzeal/gorequest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	OktaToken   = "OKTA_TOKEN"
+	OktaUrl     = "OKTA_URL"
+	usersPath   = "api/v1/users?limit=200&filter="
+	factorsPath = "api/v1/users/%s/factors"
+	rolesPath   = "api/v1/users/%s/roles"
+	active      = "ACTIVE"
+)
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+type User struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Profile struct {
+		Login     string `json:"login"`
+		Email     string `json:"email"`
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"profile"`
+	// Factors are the enrolled factors, set by FindAllUsers
+	Factors []Factor `json:"-"`
+	// Role is the highest admin role (e.g. super admin), empty for a regular user
+	Role string `json:"-"`
+}
+
+func (user User) Name() string {
+	return strings.TrimSpace(user.Profile.FirstName + " " + user.Profile.LastName)
+}
+
+// ActiveFactors returns the types of the factors that are active
+func (user User) ActiveFactors() []string {
+	var types []string
+	for _, factor := range user.Factors {
+		if factor.Status == active {
+			types = append(types, factor.FactorType)
+		}
+	}
+	return types
+}
+
+// Factor is an enrolled factor, e.g. sms or token:software:totp
+type Factor struct {
+	ID         string `json:"id"`
+	FactorType string `json:"factorType"`
+	Provider   string `json:"provider"`
+	Status     string `json:"status"`
+}
+
+type Role struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+type Okta struct {
+	Ui cli.Ui
+	// BaseUrl is the url of the org, e.g. https://example.okta.com/
+	BaseUrl string
+}
+
+// FindAllUsersWithoutTFA lists the active users without an active factor with their roles
+func (okta *Okta) FindAllUsersWithoutTFA(token string) ([]User, error) {
+	all, err := okta.FindAllUsers(token)
+	if err != nil {
+		return nil, err
+	}
+	return okta.WithoutTFA(all, token)
+}
+
+// WithoutTFA returns the users of FindAllUsers without an active factor and looks up their roles
+func (okta *Okta) WithoutTFA(all []User, token string) ([]User, error) {
+	var users []User
+	for _, user := range all {
+		if len(user.ActiveFactors()) > 0 {
+			continue
+		}
+		var err error
+		if user.Role, err = okta.Role(user.ID, token); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// FindAllUsers lists the active users with their factors, which takes a request per user
+// https://developer.okta.com/docs/reference/api/factors/#list-enrolled-factors
+func (okta *Okta) FindAllUsers(token string) ([]User, error) {
+	users, err := okta.ListUsers(token)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if users[i].Factors, err = okta.Factors(users[i].ID, token); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// ListUsers lists the active users without looking up their factors
+func (okta *Okta) ListUsers(token string) ([]User, error) {
+	var users []User
+	targetUrl := okta.baseUrl() + usersPath + url.QueryEscape(`status eq "ACTIVE"`)
+	for targetUrl != "" {
+		body, next, err := okta.get(targetUrl, token)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []User
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			return nil, err
+		}
+
+		users = append(users, page...)
+		targetUrl = next
+	}
+	return users, nil
+}
+
+// Role returns the highest admin role of the user, super admin before org admin before the rest
+func (okta *Okta) Role(userID string, token string) (string, error) {
+	body, _, err := okta.get(okta.baseUrl()+fmt.Sprintf(rolesPath, userID), token)
+	if err != nil {
+		return "", err
+	}
+
+	var roles []Role
+	if err := json.Unmarshal([]byte(body), &roles); err != nil {
+		return "", err
+	}
+
+	highest := ""
+	for _, role := range roles {
+		if highest == "" || roleRank(role.Type) > roleRank(highest) {
+			highest = role.Type
+		}
+	}
+	return strings.ToLower(strings.Replace(highest, "_", " ", -1)), nil
+}
+
+func roleRank(roleType string) int {
+	switch roleType {
+	case "SUPER_ADMIN":
+		return 2
+	case "ORG_ADMIN":
+		return 1
+	}
+	return 0
+}
+
+func (okta *Okta) Factors(userID string, token string) ([]Factor, error) {
+	body, _, err := okta.get(okta.baseUrl()+fmt.Sprintf(factorsPath, userID), token)
+	if err != nil {
+		return nil, err
+	}
+
+	var factors []Factor
+	err = json.Unmarshal([]byte(body), &factors)
+	return factors, err
+}
+
+// get returns the body and the url of the next page (if any)
+func (okta *Okta) get(targetUrl string, token string) (string, string, error) {
+	res, body, errs := gorequest.New().
+		Get(targetUrl).
+		Set("Authorization", fmt.Sprintf("SSWS %s", token)).
+		Set("Accept", "application/json").
+		End()
+	if len(errs) > 0 {
+		return "", "", errs[0]
+	}
+	if res.StatusCode != 200 {
+		return "", "", fmt.Errorf("got status code %d from Okta: %s", res.StatusCode, errorMessage(body))
+	}
+
+	next := ""
+	for _, link := range res.Header["Link"] {
+		if match := nextLink.FindStringSubmatch(link); match != nil {
+			next = match[1]
+		}
+	}
+	return body, next, nil
+}
+
+func errorMessage(body string) string {
+	response := struct {
+		ErrorSummary string `json:"errorSummary"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || response.ErrorSummary == "" {
+		return strings.TrimSpace(body)
+	}
+	return response.ErrorSummary
+}
+
+func (okta *Okta) baseUrl() string {
+	if !strings.HasSuffix(okta.BaseUrl, "/") {
+		return okta.BaseUrl + "/"
+	}
+	return okta.BaseUrl
+}
+
+func (okta *Okta) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("okta", flag.ExitOnError)
+	cmdFlags.Usage = func() { okta.Ui.Output(okta.Help()) }
+	token := ""
+	cmdFlags.StringVar(&token, "token", "", "The api token")
+	cmdFlags.StringVar(&okta.BaseUrl, "baseUrl", os.Getenv(OktaUrl), "The url of the org")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		okta.Ui.Error(err.Error())
+		return 1
+	}
+	if okta.BaseUrl == "" {
+		okta.BaseUrl = cfg.Tfa.Okta.BaseUrl
+	}
+
+	if token == "" {
+		token = os.Getenv(OktaToken)
+	}
+	if token == "" {
+		token = cfg.Tfa.Okta.Token
+	}
+	if token == "" || okta.BaseUrl == "" {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	okta.Ui.Info(fmt.Sprintf("---------- Finding users on %s without TFA: ----------", okta.baseUrl()))
+	users, err := okta.FindAllUsersWithoutTFA(token)
+	if err != nil {
+		okta.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	if len(users) == 0 {
+		okta.Ui.Info("OK: All users have TFA enabled")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Login", "Name", "Email", "Role"})
+	for _, user := range users {
+		table.Append([]string{user.Profile.Login, user.Name(), user.Profile.Email, user.Role})
+	}
+	table.Render()
+	okta.Ui.Warn(fmt.Sprintf("WARNING: %d users without TFA", len(users)))
+	return 0
+}
+
+func (okta *Okta) Help() string {
+	helpText := `
+		Usage: janitor tfa okta --token <token> --baseUrl <https://example.okta.com/>
+		  Gets the current status of TFA usage in an okta org, a user without any active factor lacks TFA
+		Options:
+		  --token   an api token of a (read only) admin (can also be set using the OKTA_TOKEN env variable)
+		  --baseUrl the url of the org (can also be set using the OKTA_URL env variable)
+		  --cfg     the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml),
+		            used for the options that aren't given as flags or env variables
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (okta *Okta) Synopsis() string {
+	return "Check TFA status in okta"
+}
@@ -0,0 +1,93 @@
+package okta_test
+
+import (
+	"fmt"
+	"github.com/freddd/janitor/tfa/okta"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOkta(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OktaSuite")
+}
+
+var _ = Describe("Users without TFA", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/users", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("filter") != `status eq "ACTIVE"` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("after") == "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/users?limit=200>; rel="self"`, server.URL))
+				w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/users?after=2&filter=status+eq+%%22ACTIVE%%22>; rel="next"`, server.URL))
+				fmt.Fprint(w, `[{"id":"1","profile":{"login":"alice@example.com","firstName":"Alice","lastName":"A"}}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"id":"2","profile":{"login":"bob@example.com"}},{"id":"3","profile":{"login":"carol@example.com"}}]`)
+		})
+		mux.HandleFunc("/api/v1/users/1/factors", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"factorType":"sms","status":"PENDING_ACTIVATION"}]`)
+		})
+		mux.HandleFunc("/api/v1/users/2/factors", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"factorType":"token:software:totp","status":"ACTIVE"}]`)
+		})
+		mux.HandleFunc("/api/v1/users/3/factors", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[]`)
+		})
+		mux.HandleFunc("/api/v1/users/1/roles", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"type":"READ_ONLY_ADMIN"},{"type":"SUPER_ADMIN"},{"type":"ORG_ADMIN"}]`)
+		})
+		mux.HandleFunc("/api/v1/users/3/roles", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[]`)
+		})
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "SSWS secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"errorCode":"E0000011","errorSummary":"Invalid token provided"}`)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists the users without an active factor across all pages", func() {
+		o := &okta.Okta{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		users, err := o.FindAllUsersWithoutTFA("secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveLen(2))
+		Expect(users[0].Profile.Login).To(Equal("alice@example.com"))
+		Expect(users[0].Name()).To(Equal("Alice A"))
+		Expect(users[0].Role).To(Equal("super admin"))
+		Expect(users[0].Factors).To(HaveLen(1))
+		Expect(users[1].Profile.Login).To(Equal("carol@example.com"))
+		Expect(users[1].Role).To(BeEmpty())
+	})
+
+	It("lists the active factors of every user", func() {
+		o := &okta.Okta{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		users, err := o.FindAllUsers("secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveLen(3))
+		Expect(users[0].ActiveFactors()).To(BeEmpty())
+		Expect(users[1].ActiveFactors()).To(Equal([]string{"token:software:totp"}))
+	})
+
+	It("returns the error summary of the api", func() {
+		o := &okta.Okta{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := o.FindAllUsersWithoutTFA("wrong")
+		Expect(err).To(MatchError("got status code 401 from Okta: Invalid token provided"))
+	})
+})
@@ -0,0 +1,223 @@
+package tfa
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Account is a user in one provider, either without 2FA or an admin with weak factors
+type Account struct {
+	ID    string `json:"id"`
+	Login string `json:"login"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+	// Role is the admin role in the provider (e.g. owner or super admin), empty for a regular user
+	Role string `json:"role,omitempty"`
+	// Factors are the enrolled factor types, only set by the providers that expose them
+	Factors  []string `json:"factors,omitempty"`
+	Provider string   `json:"provider"`
+}
+
+// Provider is a service we check 2FA in
+type Provider interface {
+	Name() string
+	UsersWithout2FA(ctx context.Context) ([]Account, error)
+}
+
+// FactorProvider is implemented by the providers that expose which factors the users have enrolled
+type FactorProvider interface {
+	Provider
+	// AdminsWithWeakFactors returns the admins that have 2FA, but only with weak factors
+	AdminsWithWeakFactors(ctx context.Context) ([]Account, error)
+}
+
+// MemberProvider is implemented by the providers that can list every user, so that the history can tell
+// someone that joined without 2FA apart from someone that disabled it
+type MemberProvider interface {
+	Provider
+	// Members returns the logins of every user, with or without 2FA
+	Members(ctx context.Context) ([]string, error)
+}
+
+// weakFactors can be intercepted or phished, the names are the ones used by okta and slack
+var weakFactors = map[string]bool{"sms": true, "call": true, "email": true, "question": true}
+
+// WeakFactors returns true if all of the factors are weak, an admin with both sms and an app is fine
+func WeakFactors(factors []string) bool {
+	for _, factor := range factors {
+		if !weakFactors[factor] {
+			return false
+		}
+	}
+	return len(factors) > 0
+}
+
+// Person is the same user across providers, correlated by email
+type Person struct {
+	Email    string
+	Name     string
+	Admin    bool
+	Accounts []Account
+}
+
+// Result of running a single provider
+type Result struct {
+	Provider string
+	Accounts []Account
+	Err      error
+}
+
+// RunProviders runs every provider concurrently, the results are in the same order as the providers
+func RunProviders(ctx context.Context, providers []Provider) []Result {
+	return run(providers, func(provider Provider) ([]Account, error) {
+		return provider.UsersWithout2FA(ctx)
+	})
+}
+
+// RunFactorProviders runs the providers that expose factors concurrently, the others are left out
+func RunFactorProviders(ctx context.Context, providers []Provider) []Result {
+	var factorProviders []Provider
+	for _, provider := range providers {
+		if _, ok := provider.(FactorProvider); ok {
+			factorProviders = append(factorProviders, provider)
+		}
+	}
+	return run(factorProviders, func(provider Provider) ([]Account, error) {
+		return provider.(FactorProvider).AdminsWithWeakFactors(ctx)
+	})
+}
+
+// RunMemberProviders runs Members of the providers that implement it concurrently, keyed by provider name
+func RunMemberProviders(ctx context.Context, providers []Provider) (map[string][]string, error) {
+	members := map[string][]string{}
+	var mutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for _, provider := range providers {
+		memberProvider, ok := provider.(MemberProvider)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(provider MemberProvider) {
+			defer wg.Done()
+			logins, err := provider.Members(ctx)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %s", provider.Name(), err)
+				}
+				return
+			}
+			members[provider.Name()] = logins
+		}(memberProvider)
+	}
+	wg.Wait()
+	return members, firstErr
+}
+
+func run(providers []Provider, fn func(provider Provider) ([]Account, error)) []Result {
+	results := make([]Result, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider Provider) {
+			defer wg.Done()
+			accounts, err := fn(provider)
+			results[i] = Result{Provider: provider.Name(), Accounts: accounts, Err: err}
+		}(i, provider)
+	}
+	wg.Wait()
+	return results
+}
+
+// Merge groups the accounts by email (case insensitive), an account without an email is a person of its
+// own. Admins come first, then the people without 2FA in the most providers
+func Merge(results []Result) []*Person {
+	byKey := map[string]*Person{}
+	var people []*Person
+	for _, result := range results {
+		for _, account := range result.Accounts {
+			key := strings.ToLower(account.Email)
+			if key == "" {
+				key = account.Provider + ":" + account.Login
+			}
+
+			person, ok := byKey[key]
+			if !ok {
+				person = &Person{Email: account.Email}
+				byKey[key] = person
+				people = append(people, person)
+			}
+			if person.Name == "" {
+				person.Name = account.Name
+			}
+			person.Admin = person.Admin || account.Admin
+			person.Accounts = append(person.Accounts, account)
+		}
+	}
+
+	sort.SliceStable(people, func(i, j int) bool {
+		if people[i].Admin != people[j].Admin {
+			return people[i].Admin
+		}
+		if len(people[i].Accounts) != len(people[j].Accounts) {
+			return len(people[i].Accounts) > len(people[j].Accounts)
+		}
+		return people[i].key() < people[j].key()
+	})
+	return people
+}
+
+func (person *Person) key() string {
+	if person.Email != "" {
+		return strings.ToLower(person.Email)
+	}
+	return person.Accounts[0].Login
+}
+
+// withContext returns as soon as ctx is done, the clients don't take a context so fn keeps running in
+// the background until it's done
+func withContext(ctx context.Context, fn func() ([]Account, error)) ([]Account, error) {
+	type result struct {
+		accounts []Account
+		err      error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		accounts, err := fn()
+		done <- result{accounts, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.accounts, r.err
+	}
+}
+
+// membersWithContext is withContext for MemberProvider.Members
+func membersWithContext(ctx context.Context, fn func() ([]string, error)) ([]string, error) {
+	done := make(chan struct{})
+	var logins []string
+	var err error
+	go func() {
+		logins, err = fn()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-done:
+		return logins, err
+	}
+}
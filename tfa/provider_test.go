@@ -0,0 +1,215 @@
+package tfa_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/freddd/janitor/tfa"
+	"github.com/freddd/janitor/tfa/github"
+	"github.com/freddd/janitor/tfa/okta"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTfa(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TfaSuite")
+}
+
+type fakeFactorProvider struct {
+	fakeProvider
+	weak []tfa.Account
+}
+
+func (p *fakeFactorProvider) AdminsWithWeakFactors(ctx context.Context) ([]tfa.Account, error) {
+	return p.weak, nil
+}
+
+type fakeProvider struct {
+	name     string
+	accounts []tfa.Account
+	err      error
+	delay    time.Duration
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) UsersWithout2FA(ctx context.Context) ([]tfa.Account, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(p.delay):
+		return p.accounts, p.err
+	}
+}
+
+var _ = Describe("Providers", func() {
+	githubProvider := &fakeProvider{name: "github", delay: 50 * time.Millisecond, accounts: []tfa.Account{
+		{Login: "alice", Email: "Alice@example.com", Provider: "github"},
+		{Login: "bob", Provider: "github"},
+	}}
+	gsuiteProvider := &fakeProvider{name: "gsuite", delay: 50 * time.Millisecond, accounts: []tfa.Account{
+		{Login: "alice@example.com", Email: "alice@example.com", Name: "Alice", Provider: "gsuite"},
+		{Login: "carol@example.com", Email: "carol@example.com", Admin: true, Provider: "gsuite"},
+	}}
+
+	It("runs the providers concurrently and keeps their order", func() {
+		failing := &fakeProvider{name: "broken", err: errors.New("unauthorized")}
+
+		start := time.Now()
+		results := tfa.RunProviders(context.Background(), []tfa.Provider{githubProvider, failing, gsuiteProvider})
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+
+		Expect(results).To(HaveLen(3))
+		Expect(results[0].Provider).To(Equal("github"))
+		Expect(results[1].Err).To(MatchError("unauthorized"))
+		Expect(results[2].Accounts).To(HaveLen(2))
+	})
+
+	It("stops waiting when the context is done", func() {
+		slow := &fakeProvider{name: "slow", delay: time.Minute}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		results := tfa.RunProviders(ctx, []tfa.Provider{slow})
+		Expect(results[0].Err).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("merges the accounts of the same person by email", func() {
+		people := tfa.Merge(tfa.RunProviders(context.Background(), []tfa.Provider{githubProvider, gsuiteProvider}))
+		Expect(people).To(HaveLen(3))
+
+		Expect(people[0].Email).To(Equal("carol@example.com"))
+		Expect(people[0].Admin).To(BeTrue())
+
+		Expect(people[1].Email).To(Equal("Alice@example.com"))
+		Expect(people[1].Name).To(Equal("Alice"))
+		Expect(people[1].Accounts).To(HaveLen(2))
+
+		Expect(people[2].Email).To(BeEmpty())
+		Expect(people[2].Accounts[0].Login).To(Equal("bob"))
+	})
+})
+
+var _ = Describe("Strict mode", func() {
+	It("only counts a factor as weak if every factor is", func() {
+		Expect(tfa.WeakFactors([]string{"sms"})).To(BeTrue())
+		Expect(tfa.WeakFactors([]string{"sms", "call"})).To(BeTrue())
+		Expect(tfa.WeakFactors([]string{"sms", "token:software:totp"})).To(BeFalse())
+		Expect(tfa.WeakFactors(nil)).To(BeFalse())
+	})
+
+	It("lists the okta users and their factors once for both reports", func() {
+		requests := map[string]int{}
+		var mutex sync.Mutex
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			requests[r.URL.Path]++
+			mutex.Unlock()
+			switch r.URL.Path {
+			case "/api/v1/users":
+				fmt.Fprint(w, `[{"id":"1","profile":{"login":"alice@example.com"}},{"id":"2","profile":{"login":"bob@example.com"}}]`)
+			case "/api/v1/users/1/factors":
+				fmt.Fprint(w, `[{"factorType":"sms","status":"ACTIVE"}]`)
+			case "/api/v1/users/2/factors":
+				fmt.Fprint(w, `[]`)
+			case "/api/v1/users/1/roles":
+				fmt.Fprint(w, `[{"type":"SUPER_ADMIN"}]`)
+			case "/api/v1/users/2/roles":
+				fmt.Fprint(w, `[]`)
+			}
+		}))
+		defer server.Close()
+
+		provider := &tfa.OktaProvider{Client: &okta.Okta{Ui: cli.NewMockUi(), BaseUrl: server.URL}, Token: "secret"}
+		without, err := provider.UsersWithout2FA(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(without).To(HaveLen(1))
+		Expect(without[0].Login).To(Equal("bob@example.com"))
+		weak, err := provider.AdminsWithWeakFactors(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(weak).To(HaveLen(1))
+		Expect(weak[0].Login).To(Equal("alice@example.com"))
+		members, err := provider.Members(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(ConsistOf("alice@example.com", "bob@example.com"))
+
+		Expect(requests).To(Equal(map[string]int{
+			"/api/v1/users":           1,
+			"/api/v1/users/1/factors": 1,
+			"/api/v1/users/2/factors": 1,
+			"/api/v1/users/1/roles":   1,
+			"/api/v1/users/2/roles":   1,
+		}))
+	})
+
+	It("only runs the providers that expose factors", func() {
+		slackProvider := &fakeFactorProvider{
+			fakeProvider: fakeProvider{name: "slack"},
+			weak:         []tfa.Account{{Login: "alice", Role: "owner", Factors: []string{"sms"}, Provider: "slack"}},
+		}
+		results := tfa.RunFactorProviders(context.Background(), []tfa.Provider{&fakeProvider{name: "github"}, slackProvider})
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Provider).To(Equal("slack"))
+		Expect(results[0].Accounts[0].Login).To(Equal("alice"))
+	})
+
+	It("fails if an admin lacks 2FA, but not for weak factors", func() {
+		slackProvider := &fakeFactorProvider{
+			fakeProvider: fakeProvider{name: "slack", accounts: []tfa.Account{{Login: "bob", Provider: "slack"}}},
+			weak:         []tfa.Account{{Login: "alice", Admin: true, Role: "owner", Factors: []string{"sms"}, Provider: "slack"}},
+		}
+		out := &bytes.Buffer{}
+		all := &tfa.All{Ui: cli.NewMockUi(), Providers: []tfa.Provider{slackProvider}, Out: out}
+		Expect(all.Run([]string{"-strict", "-history="})).To(Equal(0))
+		Expect(out.String()).To(ContainSubstring("slack (alice, owner)"))
+		Expect(out.String()).To(ContainSubstring("| sms"))
+
+		githubProvider := &fakeProvider{name: "github", accounts: []tfa.Account{{Login: "carol", Admin: true, Role: "owner", Provider: "github"}}}
+		all = &tfa.All{Ui: cli.NewMockUi(), Providers: []tfa.Provider{slackProvider, githubProvider}, Out: &bytes.Buffer{}}
+		Expect(all.Run([]string{"-strict", "-history="})).To(Equal(1))
+		Expect(all.Run([]string{"-history="})).To(Equal(0))
+	})
+})
+
+var _ = Describe("GitHubProvider", func() {
+	It("looks up the email and admin role of the members", func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/orgs/acme/members", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("role") == "admin" {
+				fmt.Fprint(w, `[{"login":"alice","id":1}]`)
+				return
+			}
+			fmt.Fprint(w, `[{"login":"alice","id":1},{"login":"bob","id":2}]`)
+		})
+		mux.HandleFunc("/users/alice", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"login":"alice","name":"Alice","email":"alice@example.com"}`)
+		})
+		mux.HandleFunc("/users/bob", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"login":"bob","name":null,"email":null}`)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		provider := &tfa.GitHubProvider{
+			Client:       &github.GitHub{Ui: cli.NewMockUi(), BaseUrl: server.URL},
+			Organization: "acme",
+			ApiKey:       "secret",
+		}
+		accounts, err := provider.UsersWithout2FA(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(accounts).To(Equal([]tfa.Account{
+			{ID: "1", Login: "alice", Email: "alice@example.com", Name: "Alice", Admin: true, Role: "owner", Provider: "github"},
+			{ID: "2", Login: "bob", Provider: "github"},
+		}))
+	})
+})
@@ -0,0 +1,492 @@
+package tfa
+
+import (
+	"context"
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tfa/atlassian"
+	"github.com/freddd/janitor/tfa/github"
+	"github.com/freddd/janitor/tfa/gitlab"
+	"github.com/freddd/janitor/tfa/google"
+	"github.com/freddd/janitor/tfa/okta"
+	"github.com/freddd/janitor/tfa/slack"
+	"github.com/mitchellh/cli"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// GitHubProvider checks the members of an organization, the email is the public email of the profile
+type GitHubProvider struct {
+	Client       *github.GitHub
+	Organization string
+	ApiKey       string
+}
+
+func (p *GitHubProvider) Name() string {
+	return "github"
+}
+
+func (p *GitHubProvider) UsersWithout2FA(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		members, err := p.Client.FindAllUsersWithoutTFA(p.Organization, p.ApiKey)
+		if err != nil {
+			return nil, err
+		}
+		admins, err := p.Client.FindAllAdminsWithoutTFA(p.Organization, p.ApiKey)
+		if err != nil {
+			return nil, err
+		}
+		isAdmin := map[string]bool{}
+		for _, admin := range admins {
+			isAdmin[admin.Login] = true
+		}
+
+		var accounts []Account
+		for _, member := range members {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			user, err := p.Client.FindUser(member.Login, p.ApiKey)
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, Account{
+				ID:       strconv.Itoa(member.ID),
+				Login:    member.Login,
+				Email:    user.Email,
+				Name:     user.Name,
+				Admin:    isAdmin[member.Login],
+				Role:     githubRole(isAdmin[member.Login]),
+				Provider: p.Name(),
+			})
+		}
+		return accounts, nil
+	})
+}
+
+func (p *GitHubProvider) Members(ctx context.Context) ([]string, error) {
+	return membersWithContext(ctx, func() ([]string, error) {
+		members, err := p.Client.FindAllMembers(p.Organization, p.ApiKey)
+		var logins []string
+		for _, member := range members {
+			logins = append(logins, member.Login)
+		}
+		return logins, err
+	})
+}
+
+func githubRole(admin bool) string {
+	if admin {
+		return "owner"
+	}
+	return ""
+}
+
+// GsuiteProvider checks the users of a gsuite domain with a service account
+type GsuiteProvider struct {
+	Client  *google.Gsuite
+	KeyFile string
+	Subject string
+	OrgUnit string
+}
+
+func (p *GsuiteProvider) Name() string {
+	return "gsuite"
+}
+
+func (p *GsuiteProvider) UsersWithout2FA(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		token, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		users, err := p.Client.FindAllUsersWithoutTFA(token, p.OrgUnit)
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, user := range users {
+			accounts = append(accounts, Account{
+				ID:       user.ID,
+				Login:    user.PrimaryEmail,
+				Email:    user.PrimaryEmail,
+				Name:     user.Name.FullName,
+				Admin:    user.Role() != "",
+				Role:     user.Role(),
+				Provider: p.Name(),
+			})
+		}
+		return accounts, nil
+	})
+}
+
+func (p *GsuiteProvider) Members(ctx context.Context) ([]string, error) {
+	return membersWithContext(ctx, func() ([]string, error) {
+		token, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		users, err := p.Client.FindAllUsers(token, p.OrgUnit)
+		var logins []string
+		for _, user := range users {
+			logins = append(logins, user.PrimaryEmail)
+		}
+		return logins, err
+	})
+}
+
+func (p *GsuiteProvider) token() (string, error) {
+	serviceAccount, err := google.ReadServiceAccount(p.KeyFile)
+	if err != nil {
+		return "", err
+	}
+	return serviceAccount.Token(p.Subject, google.DirectoryScope)
+}
+
+// GitlabProvider checks the users of a self-managed instance
+type GitlabProvider struct {
+	Client *gitlab.Gitlab
+	Token  string
+}
+
+func (p *GitlabProvider) Name() string {
+	return "gitlab"
+}
+
+func (p *GitlabProvider) Members(ctx context.Context) ([]string, error) {
+	return membersWithContext(ctx, func() ([]string, error) {
+		users, err := p.Client.FindAllUsers(p.Token)
+		var logins []string
+		for _, user := range users {
+			logins = append(logins, user.Username)
+		}
+		return logins, err
+	})
+}
+
+func (p *GitlabProvider) UsersWithout2FA(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		users, err := p.Client.FindAllUsersWithoutTFA(p.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, user := range users {
+			accounts = append(accounts, Account{
+				ID:       strconv.Itoa(user.ID),
+				Login:    user.Username,
+				Email:    user.Email,
+				Name:     user.Name,
+				Admin:    user.IsAdmin,
+				Role:     gitlabRole(user.IsAdmin),
+				Provider: p.Name(),
+			})
+		}
+		return accounts, nil
+	})
+}
+
+func gitlabRole(admin bool) string {
+	if admin {
+		return "admin"
+	}
+	return ""
+}
+
+// SlackProvider checks the members of a workspace, the members are listed once and shared by the reports
+type SlackProvider struct {
+	Client *slack.Slack
+	Token  string
+
+	mutex   sync.Mutex
+	listed  bool
+	members []slack.Member
+}
+
+func (p *SlackProvider) Name() string {
+	return "slack"
+}
+
+// allMembers pages through users.list the first time it's called
+func (p *SlackProvider) allMembers() ([]slack.Member, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.listed {
+		return p.members, nil
+	}
+	members, err := p.Client.FindAllMembers(p.Token)
+	if err != nil {
+		return nil, err
+	}
+	p.members, p.listed = members, true
+	return members, nil
+}
+
+func (p *SlackProvider) UsersWithout2FA(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		members, err := p.allMembers()
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, member := range slack.WithoutTFA(members) {
+			accounts = append(accounts, p.account(member))
+		}
+		return accounts, nil
+	})
+}
+
+func (p *SlackProvider) AdminsWithWeakFactors(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		members, err := p.allMembers()
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, member := range members {
+			account := p.account(member)
+			if account.Admin && *member.Has2FA && WeakFactors(account.Factors) {
+				accounts = append(accounts, account)
+			}
+		}
+		return accounts, nil
+	})
+}
+
+func (p *SlackProvider) Members(ctx context.Context) ([]string, error) {
+	return membersWithContext(ctx, func() ([]string, error) {
+		members, err := p.allMembers()
+		var logins []string
+		for _, member := range members {
+			logins = append(logins, member.Name)
+		}
+		return logins, err
+	})
+}
+
+func (p *SlackProvider) account(member slack.Member) Account {
+	account := Account{
+		ID:       member.ID,
+		Login:    member.Name,
+		Email:    member.Profile.Email,
+		Name:     member.Profile.RealName,
+		Admin:    member.Role() != "",
+		Role:     member.Role(),
+		Provider: p.Name(),
+	}
+	if member.TwoFactorType != "" {
+		account.Factors = []string{member.TwoFactorType}
+	}
+	return account
+}
+
+// OktaProvider checks the users of an org, the users and their factors are listed once and shared by the
+// reports since it takes a request per user
+type OktaProvider struct {
+	Client *okta.Okta
+	Token  string
+
+	mutex  sync.Mutex
+	listed bool
+	users  []okta.User
+}
+
+func (p *OktaProvider) Name() string {
+	return "okta"
+}
+
+// allUsers lists the users with their factors the first time it's called
+func (p *OktaProvider) allUsers() ([]okta.User, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.listed {
+		return p.users, nil
+	}
+	users, err := p.Client.FindAllUsers(p.Token)
+	if err != nil {
+		return nil, err
+	}
+	p.users, p.listed = users, true
+	return users, nil
+}
+
+func (p *OktaProvider) UsersWithout2FA(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		all, err := p.allUsers()
+		if err != nil {
+			return nil, err
+		}
+		users, err := p.Client.WithoutTFA(all, p.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, user := range users {
+			accounts = append(accounts, p.account(user))
+		}
+		return accounts, nil
+	})
+}
+
+// AdminsWithWeakFactors only looks up the roles of the users with weak factors
+func (p *OktaProvider) AdminsWithWeakFactors(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		users, err := p.allUsers()
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, user := range users {
+			if !WeakFactors(user.ActiveFactors()) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if user.Role, err = p.Client.Role(user.ID, p.Token); err != nil {
+				return nil, err
+			}
+			if user.Role != "" {
+				accounts = append(accounts, p.account(user))
+			}
+		}
+		return accounts, nil
+	})
+}
+
+func (p *OktaProvider) Members(ctx context.Context) ([]string, error) {
+	return membersWithContext(ctx, func() ([]string, error) {
+		users, err := p.allUsers()
+		var logins []string
+		for _, user := range users {
+			logins = append(logins, user.Profile.Login)
+		}
+		return logins, err
+	})
+}
+
+func (p *OktaProvider) account(user okta.User) Account {
+	return Account{
+		ID:       user.ID,
+		Login:    user.Profile.Login,
+		Email:    user.Profile.Email,
+		Name:     user.Name(),
+		Admin:    user.Role != "",
+		Role:     user.Role,
+		Factors:  user.ActiveFactors(),
+		Provider: p.Name(),
+	}
+}
+
+// BitbucketProvider checks the members of a workspace, bitbucket doesn't expose emails so the accounts
+// aren't merged with other providers
+type BitbucketProvider struct {
+	Client    *atlassian.Bitbucket
+	Workspace string
+	Token     string
+}
+
+func (p *BitbucketProvider) Name() string {
+	return "bitbucket"
+}
+
+func (p *BitbucketProvider) UsersWithout2FA(ctx context.Context) ([]Account, error) {
+	return withContext(ctx, func() ([]Account, error) {
+		members, err := p.Client.FindAllUsersWithoutTFA(p.Workspace, p.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []Account
+		for _, membership := range members {
+			accounts = append(accounts, Account{
+				ID:       membership.User.AccountID,
+				Login:    membership.User.Nickname,
+				Name:     membership.User.DisplayName,
+				Admin:    membership.Admin(),
+				Role:     bitbucketRole(membership),
+				Provider: p.Name(),
+			})
+		}
+		return accounts, nil
+	})
+}
+
+func (p *BitbucketProvider) Members(ctx context.Context) ([]string, error) {
+	return membersWithContext(ctx, func() ([]string, error) {
+		members, err := p.Client.FindAllMembers(p.Workspace, p.Token)
+		var logins []string
+		for _, membership := range members {
+			logins = append(logins, membership.User.Nickname)
+		}
+		return logins, err
+	})
+}
+
+func bitbucketRole(membership atlassian.Membership) string {
+	if membership.Admin() {
+		return membership.Permission
+	}
+	return ""
+}
+
+// ConfiguredProviders returns the providers that have their env variables, or their section in the config,
+// set. An env variable takes precedence over the config
+func ConfiguredProviders(ui cli.Ui, cfg config.Tfa) []Provider {
+	var providers []Provider
+	if key, org := env(github.GithubKey, cfg.GitHub.ApiKey), env(github.GithubOrg, cfg.GitHub.Organization); key != "" && org != "" {
+		providers = append(providers, &GitHubProvider{
+			Client:       &github.GitHub{Ui: ui, BaseUrl: cfg.GitHub.BaseUrl},
+			Organization: org,
+			ApiKey:       key,
+		})
+	}
+	if key, subject := env(google.GsuiteKey, cfg.Gsuite.KeyFile), env(google.GsuiteSubject, cfg.Gsuite.Subject); key != "" && subject != "" {
+		providers = append(providers, &GsuiteProvider{
+			Client:  &google.Gsuite{Ui: ui, BaseUrl: cfg.Gsuite.BaseUrl},
+			KeyFile: key,
+			Subject: subject,
+			OrgUnit: cfg.Gsuite.OrgUnit,
+		})
+	}
+	if token := env(gitlab.GitlabToken, cfg.Gitlab.Token); token != "" {
+		providers = append(providers, &GitlabProvider{
+			Client: &gitlab.Gitlab{Ui: ui, BaseUrl: env(gitlab.GitlabUrl, cfg.Gitlab.BaseUrl)},
+			Token:  token,
+		})
+	}
+	if token := env(slack.SlackToken, cfg.Slack.Token); token != "" {
+		providers = append(providers, &SlackProvider{
+			Client: &slack.Slack{Ui: ui, BaseUrl: cfg.Slack.BaseUrl},
+			Token:  token,
+		})
+	}
+	if token, baseUrl := env(okta.OktaToken, cfg.Okta.Token), env(okta.OktaUrl, cfg.Okta.BaseUrl); token != "" && baseUrl != "" {
+		providers = append(providers, &OktaProvider{
+			Client: &okta.Okta{Ui: ui, BaseUrl: baseUrl},
+			Token:  token,
+		})
+	}
+	if token, workspace := env(atlassian.BitbucketToken, cfg.Bitbucket.Token), env(atlassian.BitbucketWorkspace, cfg.Bitbucket.Workspace); token != "" && workspace != "" {
+		providers = append(providers, &BitbucketProvider{
+			Client:    &atlassian.Bitbucket{Ui: ui, BaseUrl: cfg.Bitbucket.BaseUrl},
+			Workspace: workspace,
+			Token:     token,
+		})
+	}
+	return providers
+}
+
+// env returns the env variable, or the value from the config if it isn't set
+func env(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
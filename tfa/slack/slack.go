@@ -0,0 +1,224 @@
+package slack
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/mitchellh/cli"
+	"github.com/olekukonko/tablewriter"
+	"github.com/parnurzeal/gorequest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultBaseUrl = "https://slack.com/api/"
+	SlackToken     = "SLACK_TOKEN"
+	usersPath      = "users.list"
+	slackbot       = "USLACKBOT"
+	pageSize       = 200
+)
+
+// Member of a workspace, has_2fa is only included when the token belongs to an admin or owner
+type Member struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Deleted        bool   `json:"deleted"`
+	IsBot          bool   `json:"is_bot"`
+	IsAdmin        bool   `json:"is_admin"`
+	IsOwner        bool   `json:"is_owner"`
+	IsPrimaryOwner bool   `json:"is_primary_owner"`
+	Has2FA         *bool  `json:"has_2fa"`
+	// TwoFactorType is app or sms when has_2fa is true
+	TwoFactorType string `json:"two_factor_type"`
+	Profile       struct {
+		RealName string `json:"real_name"`
+		Email    string `json:"email"`
+	} `json:"profile"`
+}
+
+// Role is the highest admin role, empty for a regular member
+func (member Member) Role() string {
+	switch {
+	case member.IsPrimaryOwner:
+		return "primary owner"
+	case member.IsOwner:
+		return "owner"
+	case member.IsAdmin:
+		return "admin"
+	}
+	return ""
+}
+
+type UsersResponse struct {
+	Ok               bool     `json:"ok"`
+	Error            string   `json:"error"`
+	Members          []Member `json:"members"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+type Slack struct {
+	Ui cli.Ui
+	// BaseUrl defaults to DefaultBaseUrl
+	BaseUrl string
+}
+
+// FindAllUsersWithoutTFA lists the active humans without 2FA
+func (slack *Slack) FindAllUsersWithoutTFA(token string) ([]Member, error) {
+	all, err := slack.FindAllMembers(token)
+	if err != nil {
+		return nil, err
+	}
+	return WithoutTFA(all), nil
+}
+
+// WithoutTFA returns the members of FindAllMembers without 2FA
+func WithoutTFA(all []Member) []Member {
+	var members []Member
+	for _, member := range all {
+		if !*member.Has2FA {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// FindAllMembers lists the active humans, it's an error if has_2fa isn't visible to the token since
+// everyone would look like they are fine
+// https://api.slack.com/methods/users.list
+func (slack *Slack) FindAllMembers(token string) ([]Member, error) {
+	var members []Member
+	cursor := ""
+	for {
+		query := url.Values{"limit": {strconv.Itoa(pageSize)}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		res, body, errs := gorequest.New().
+			Get(slack.baseUrl()+usersPath+"?"+query.Encode()).
+			Set("Authorization", fmt.Sprintf("Bearer %s", token)).
+			End()
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+		if res.StatusCode != 200 {
+			return nil, fmt.Errorf("got status code %d from Slack: %s", res.StatusCode, strings.TrimSpace(body))
+		}
+
+		response := UsersResponse{}
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			return nil, err
+		}
+		if !response.Ok {
+			return nil, fmt.Errorf("got error from Slack: %s", response.Error)
+		}
+
+		for _, member := range response.Members {
+			if member.Deleted || member.IsBot || member.ID == slackbot {
+				continue
+			}
+			if member.Has2FA == nil {
+				return nil, fmt.Errorf("has_2fa of %s isn't visible, the token has to belong to an admin or owner", member.Name)
+			}
+			members = append(members, member)
+		}
+
+		cursor = response.ResponseMetadata.NextCursor
+		if cursor == "" {
+			return members, nil
+		}
+	}
+}
+
+func (slack *Slack) baseUrl() string {
+	if slack.BaseUrl == "" {
+		return DefaultBaseUrl
+	}
+	if !strings.HasSuffix(slack.BaseUrl, "/") {
+		return slack.BaseUrl + "/"
+	}
+	return slack.BaseUrl
+}
+
+func (slack *Slack) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("slack", flag.ExitOnError)
+	cmdFlags.Usage = func() { slack.Ui.Output(slack.Help()) }
+	token := ""
+	cmdFlags.StringVar(&token, "token", "", "The token")
+	cmdFlags.StringVar(&slack.BaseUrl, "baseUrl", DefaultBaseUrl, "The base url of the api")
+	cfgPath := ""
+	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+
+	if err := cmdFlags.Parse(args); err != nil {
+		cmdFlags.Usage()
+		return 1
+	}
+
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tfa")
+	if err != nil {
+		slack.Ui.Error(err.Error())
+		return 1
+	}
+	set := map[string]bool{}
+	cmdFlags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["baseUrl"] && cfg.Tfa.Slack.BaseUrl != "" {
+		slack.BaseUrl = cfg.Tfa.Slack.BaseUrl
+	}
+
+	if token == "" {
+		token = os.Getenv(SlackToken)
+	}
+	if token == "" {
+		token = cfg.Tfa.Slack.Token
+		if token == "" {
+			cmdFlags.Usage()
+			return 1
+		}
+	}
+
+	slack.Ui.Info("---------- Finding members on Slack without TFA: ----------")
+	members, err := slack.FindAllUsersWithoutTFA(token)
+	if err != nil {
+		slack.Ui.Error(fmt.Sprintf("CRITICAL: %s", err))
+		return 1
+	}
+
+	if len(members) == 0 {
+		slack.Ui.Info("OK: All members have TFA enabled")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Real name", "Email", "Role"})
+	for _, member := range members {
+		table.Append([]string{member.Name, member.Profile.RealName, member.Profile.Email, member.Role()})
+	}
+	table.Render()
+	slack.Ui.Warn(fmt.Sprintf("WARNING: %d members without TFA", len(members)))
+	return 0
+}
+
+func (slack *Slack) Help() string {
+	helpText := `
+		Usage: janitor tfa slack --token <token>
+		  Gets the current status of TFA usage in a slack workspace
+		Options:
+		  --token   a user token of an admin or owner with the users:read and users:read.email scopes
+		            (can also be set using the SLACK_TOKEN env variable)
+		  --baseUrl the base url of the api (defaults to https://slack.com/api/)
+		  --cfg     the global config file (defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml),
+		            used for the options that aren't given as flags or env variables
+		`
+
+	return strings.TrimSpace(helpText)
+}
+
+func (slack *Slack) Synopsis() string {
+	return "Check TFA status in slack"
+}
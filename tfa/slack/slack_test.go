@@ -0,0 +1,87 @@
+package slack_test
+
+import (
+	"fmt"
+	"github.com/freddd/janitor/tfa/slack"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlack(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SlackSuite")
+}
+
+var _ = Describe("Members without TFA", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Header.Get("Authorization") {
+			case "Bearer bot":
+				fmt.Fprint(w, `{"ok":true,"members":[{"id":"U1","name":"alice"}]}`)
+				return
+			case "Bearer admin":
+			default:
+				fmt.Fprint(w, `{"ok":false,"error":"invalid_auth"}`)
+				return
+			}
+
+			switch r.URL.Query().Get("cursor") {
+			case "":
+				fmt.Fprint(w, `{"ok":true,"members":[
+					{"id":"USLACKBOT","name":"slackbot","has_2fa":false},
+					{"id":"U1","name":"alice","is_admin":true,"is_owner":true,"has_2fa":true,"two_factor_type":"sms"},
+					{"id":"U2","name":"bob","is_admin":true,"has_2fa":false,"profile":{"email":"bob@example.com"}}
+				],"response_metadata":{"next_cursor":"next"}}`)
+			case "next":
+				fmt.Fprint(w, `{"ok":true,"members":[
+					{"id":"U3","name":"carol","deleted":true,"has_2fa":false},
+					{"id":"U4","name":"deploy","is_bot":true,"has_2fa":false},
+					{"id":"U5","name":"dave","has_2fa":false}
+				],"response_metadata":{"next_cursor":""}}`)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists the active humans without 2FA across all pages", func() {
+		s := &slack.Slack{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		members, err := s.FindAllUsersWithoutTFA("admin")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(HaveLen(2))
+		Expect(members[0].Name).To(Equal("bob"))
+		Expect(members[0].Profile.Email).To(Equal("bob@example.com"))
+		Expect(members[1].Name).To(Equal("dave"))
+	})
+
+	It("lists every active human with the factor type and role", func() {
+		s := &slack.Slack{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		members, err := s.FindAllMembers("admin")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(members).To(HaveLen(3))
+		Expect(members[0].TwoFactorType).To(Equal("sms"))
+		Expect(members[0].Role()).To(Equal("owner"))
+		Expect(members[1].Role()).To(Equal("admin"))
+		Expect(members[2].Role()).To(BeEmpty())
+	})
+
+	It("fails when has_2fa isn't visible to the token", func() {
+		s := &slack.Slack{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := s.FindAllUsersWithoutTFA("bot")
+		Expect(err).To(MatchError("has_2fa of alice isn't visible, the token has to belong to an admin or owner"))
+	})
+
+	It("returns the error of the api", func() {
+		s := &slack.Slack{Ui: cli.NewMockUi(), BaseUrl: server.URL}
+		_, err := s.FindAllUsersWithoutTFA("wrong")
+		Expect(err).To(MatchError("got error from Slack: invalid_auth"))
+	})
+})
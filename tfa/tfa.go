@@ -1,10 +1,14 @@
 package tfa
 
 import (
-	"github.com/mitchellh/cli"
-	"strings"
+	"github.com/freddd/janitor/tfa/atlassian"
 	"github.com/freddd/janitor/tfa/github"
+	"github.com/freddd/janitor/tfa/gitlab"
 	"github.com/freddd/janitor/tfa/google"
+	"github.com/freddd/janitor/tfa/okta"
+	"github.com/freddd/janitor/tfa/slack"
+	"github.com/mitchellh/cli"
+	"strings"
 )
 
 type TfaCommand struct {
@@ -22,26 +26,43 @@ func (t *TfaCommand) Run(args []string) int {
 		"gsuite": func() (cli.Command, error) {
 			return &google.Gsuite{Ui: t.Ui}, nil
 		},
+		"gitlab": func() (cli.Command, error) {
+			return &gitlab.Gitlab{Ui: t.Ui}, nil
+		},
+		"slack": func() (cli.Command, error) {
+			return &slack.Slack{Ui: t.Ui}, nil
+		},
+		"okta": func() (cli.Command, error) {
+			return &okta.Okta{Ui: t.Ui}, nil
+		},
+		"bitbucket": func() (cli.Command, error) {
+			return &atlassian.Bitbucket{Ui: t.Ui}, nil
+		},
+		"all": func() (cli.Command, error) {
+			return &All{Ui: t.Ui}, nil
+		},
+		"history": func() (cli.Command, error) {
+			return &History{Ui: t.Ui}, nil
+		},
 	}
 
-	if exitStatus, err := tfa.Run(); err != nil {
+	exitStatus, err := tfa.Run()
+	if err != nil {
 		t.Ui.Error(err.Error())
-		return exitStatus
-	} else {
-		return exitStatus
 	}
-	return 0
+	return exitStatus
 }
 
 func (t *TfaCommand) Help() string {
 	helpText := `
-		Usage: janitor tfa <github/gsuite>
-		  Gets the current status of TFA usage on github/gsuite
+		Usage: janitor tfa <github/gsuite/gitlab/slack/okta/bitbucket/all/history>
+		  Gets the current status of TFA usage on github/gsuite/gitlab/slack/okta/bitbucket, or on all of them at once
+		  and how it changes over time. Only the runs of all are recorded for history
 		`
 
 	return strings.TrimSpace(helpText)
 }
 
 func (t *TfaCommand) Synopsis() string {
-	return "Check TFA status in either github or gsuite"
-}
\ No newline at end of file
+	return "Check TFA status in github, gsuite, gitlab, slack, okta or bitbucket"
+}
@@ -0,0 +1,193 @@
+package tracker
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	defaultArchiveMaxDepth int   = 3
+	defaultArchiveMaxSize  int64 = 100 * 1024 * 1024
+	// archiveSeparator separates the path of an archive from the path of an entry in it
+	archiveSeparator string = "!/"
+)
+
+// archiveKind sniffs the magic bytes, a tar archive has its magic after the name of the first entry
+func archiveKind(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return "zip"
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "bzip2"
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return "tar"
+	}
+	return ""
+}
+
+// processArchive scans every entry of the archive, compressed content is scanned as if it wasn't
+// compressed. Every layer counts towards the max depth, compressed ones too, or a gzip quine would recurse
+// forever. Failing entries don't stop the rest of the archive from being scanned
+func (tracker *Tracker) processArchive(path string, kind string, reader io.Reader, original io.Reader, depth int) ([]Finding, error) {
+	maxDepth, maxSize := tracker.archiveLimits()
+	if depth >= maxDepth {
+		// only the archives that are cut off are worth a warning, not every one when scanning them is disabled
+		if maxDepth > 0 {
+			tracker.skippedMutex.Lock()
+			tracker.skipped = append(tracker.skipped, path)
+			tracker.skippedMutex.Unlock()
+		}
+		return nil, nil
+	}
+
+	switch kind {
+	case "gzip":
+		decompressed, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		defer decompressed.Close()
+		return tracker.processReader(path, limit(path, decompressed, maxSize), depth+1)
+	case "bzip2":
+		return tracker.processReader(path, limit(path, bzip2.NewReader(reader), maxSize), depth+1)
+	case "tar":
+		return tracker.processTar(path, tar.NewReader(reader), depth, maxSize)
+	case "zip":
+		return tracker.processZip(path, reader, original, depth, maxSize)
+	}
+	return nil, fmt.Errorf("%s: unknown archive %s", path, kind)
+}
+
+func (tracker *Tracker) processTar(path string, archive *tar.Reader, depth int, maxSize int64) ([]Finding, error) {
+	var findings []Finding
+	var errs []string
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", path, err))
+			break
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		entryPath := path + archiveSeparator + strings.TrimPrefix(header.Name, "./")
+		found, err := tracker.processReader(entryPath, limit(entryPath, archive, maxSize), depth+1)
+		findings = append(findings, found...)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return findings, joinErrors(errs)
+}
+
+// processZip uses the file directly if the zip is on disk, a nested zip has to be read into memory since
+// the central directory is at the end
+func (tracker *Tracker) processZip(path string, reader io.Reader, original io.Reader, depth int, maxSize int64) ([]Finding, error) {
+	var archive *zip.Reader
+	if file, ok := original.(*os.File); ok && depth == 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		archive, err = zip.NewReader(file, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	} else {
+		content, err := ioutil.ReadAll(limit(path, reader, maxSize))
+		if err != nil {
+			return nil, err
+		}
+		archive, err = zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	var findings []Finding
+	var errs []string
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		entryPath := path + archiveSeparator + entry.Name
+		content, err := entry.Open()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", entryPath, err))
+			continue
+		}
+		found, err := tracker.processReader(entryPath, limit(entryPath, content, maxSize), depth+1)
+		content.Close()
+
+		findings = append(findings, found...)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return findings, joinErrors(errs)
+}
+
+func (tracker *Tracker) archiveLimits() (int, int64) {
+	maxDepth := defaultArchiveMaxDepth
+	maxSize := defaultArchiveMaxSize
+	if tracker.Cfg != nil {
+		if tracker.Cfg.Archives.MaxDepth != nil {
+			maxDepth = *tracker.Cfg.Archives.MaxDepth
+		}
+		if tracker.Cfg.Archives.MaxSize != 0 {
+			maxSize = tracker.Cfg.Archives.MaxSize
+		}
+	}
+	return maxDepth, maxSize
+}
+
+// limitedReader fails instead of silently truncating, so that a partially scanned entry is reported. The
+// errors of the decompressed or extracted content get the path, on their own they don't tell which it is
+type limitedReader struct {
+	path string
+	r    io.Reader
+	max  int64
+	left int64
+}
+
+func limit(path string, r io.Reader, max int64) io.Reader {
+	return &limitedReader{path: path, r: r, max: max, left: max + 1}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left <= 0 {
+		return n, fmt.Errorf("%s: exceeds the size limit of %d bytes", l.path, l.max)
+	}
+	if err != nil && err != io.EOF {
+		return n, fmt.Errorf("%s: %s", l.path, err)
+	}
+	return n, err
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "\n"))
+}
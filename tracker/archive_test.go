@@ -0,0 +1,134 @@
+package tracker_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const properties = "spring.datasource.password=hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\n"
+
+func zipOf(files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Write(content)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func gzipOf(content []byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(content)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func tarGzOf(files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		Expect(w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := w.Write(content)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(w.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("Archives", func() {
+	var dir string
+
+	scan := func(cfg *config.Tracker, name string, content []byte) ([]tracker.Finding, *cli.MockUi) {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, content, 0644)).To(Succeed())
+
+		ui := cli.NewMockUi()
+		t := &tracker.Tracker{Ui: ui, Cfg: cfg}
+		findings, err := t.FindAllPossibleKeys([]string{path})
+		Expect(err).NotTo(HaveOccurred())
+		return findings, ui
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-archive")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reports findings in nested archives with a nested path", func() {
+		jar := zipOf(map[string][]byte{"config/application.properties": []byte(properties)})
+		war := zipOf(map[string][]byte{"lib/app.jar": jar, "logo.png": {0x89, 'P', 'N', 'G', 0x00}})
+
+		findings, _ := scan(&config.Tracker{}, "app.war", war)
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].File).To(Equal(filepath.Join(dir, "app.war") + "!/lib/app.jar!/config/application.properties"))
+		Expect(findings[0].Line).To(Equal(1))
+	})
+
+	It("scans compressed tarballs", func() {
+		findings, _ := scan(&config.Tracker{}, "release.tar.gz", tarGzOf(map[string][]byte{"./etc/app.conf": []byte(properties)}))
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].File).To(HaveSuffix("release.tar.gz!/etc/app.conf"))
+	})
+
+	It("stops at the max depth", func() {
+		jar := zipOf(map[string][]byte{"application.properties": []byte(properties)})
+		war := zipOf(map[string][]byte{"app.jar": jar})
+
+		depth := 1
+		findings, ui := scan(&config.Tracker{Archives: config.Archives{MaxDepth: &depth}}, "app.war", war)
+		Expect(findings).To(BeEmpty())
+		Expect(ui.ErrorWriter.String()).To(ContainSubstring("app.war!/app.jar: not scanned, it is nested deeper than archives.maxDepth (1)"))
+	})
+
+	It("counts every compressed layer towards the max depth", func() {
+		nested := []byte(properties)
+		for i := 0; i < 3; i++ {
+			nested = gzipOf(nested)
+		}
+
+		findings, _ := scan(&config.Tracker{}, "nested.gz", nested)
+		Expect(findings).To(HaveLen(1))
+
+		nested = gzipOf(nested)
+		findings, _ = scan(&config.Tracker{}, "nested.gz", nested)
+		Expect(findings).To(BeEmpty())
+	})
+
+	It("doesn't descend into archives with a max depth of 0", func() {
+		depth := 0
+		findings, ui := scan(&config.Tracker{Archives: config.Archives{MaxDepth: &depth}}, "release.tar.gz", tarGzOf(map[string][]byte{"app.conf": []byte(properties)}))
+		Expect(findings).To(BeEmpty())
+		Expect(ui.ErrorWriter.String()).To(BeEmpty())
+	})
+
+	It("reports entries above the size limit", func() {
+		archive := zipOf(map[string][]byte{"big.txt": bytes.Repeat([]byte("a"), 2048), "small.properties": []byte(properties)})
+
+		findings, ui := scan(&config.Tracker{Archives: config.Archives{MaxSize: 1024}}, "app.zip", archive)
+		Expect(findings).To(HaveLen(1))
+		Expect(ui.ErrorWriter.String()).To(ContainSubstring("app.zip!/big.txt: exceeds the size limit of 1024 bytes"))
+	})
+})
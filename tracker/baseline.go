@@ -0,0 +1,92 @@
+package tracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// baseline holds the fingerprints of accepted findings, the file has the same format as -format json
+type baseline map[string]bool
+
+func readBaseline(path string) (baseline, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	if err := json.Unmarshal(file, &findings); err != nil {
+		return nil, err
+	}
+
+	accepted := baseline{}
+	for _, finding := range findings {
+		accepted[finding.Fingerprint] = true
+	}
+	return accepted, nil
+}
+
+func writeBaseline(path string, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+
+	content, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// filter returns the findings that aren't in the baseline
+func (accepted baseline) filter(findings []Finding) []Finding {
+	var result []Finding
+	for _, finding := range findings {
+		if !accepted[finding.Fingerprint] {
+			result = append(result, finding)
+		}
+	}
+	return result
+}
+
+// withoutBaseline drops the baseline from the files to scan, its fingerprints are sha256 hex strings that
+// would be reported as findings and the baseline would never settle
+func withoutBaseline(files []string, path string) []string {
+	baselinePath, err := filepath.Abs(path)
+	if err != nil {
+		return files
+	}
+	var result []string
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil && abs == baselinePath {
+			continue
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// withoutBaselineHistory drops the findings of the baseline from a scan of the history of the repo, where
+// the baseline is likely committed
+func withoutBaselineHistory(findings []Finding, repoPath string, path string) []Finding {
+	repo, err := filepath.Abs(repoPath)
+	if err != nil {
+		return findings
+	}
+	baselinePath, err := filepath.Abs(path)
+	if err != nil {
+		return findings
+	}
+	rel, err := filepath.Rel(repo, baselinePath)
+	if err != nil {
+		return findings
+	}
+	var result []Finding
+	for _, finding := range findings {
+		if finding.File != filepath.ToSlash(rel) {
+			result = append(result, finding)
+		}
+	}
+	return result
+}
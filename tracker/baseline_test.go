@@ -0,0 +1,84 @@
+package tracker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Baseline", func() {
+	var dir string
+	var cfgPath string
+	var baselinePath string
+
+	run := func(args ...string) []tracker.Finding {
+		out := &bytes.Buffer{}
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Out: out}
+
+		wd, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(dir)).To(Succeed())
+		defer os.Chdir(wd)
+
+		Expect(t.Run(append([]string{"-cfg", cfgPath, "-format", "json"}, args...))).To(Equal(0))
+
+		var findings []tracker.Finding
+		if out.Len() > 0 {
+			Expect(json.Unmarshal(out.Bytes(), &findings)).To(Succeed())
+		}
+		return findings
+	}
+
+	write := func(content string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte(content), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-baseline")
+		Expect(err).NotTo(HaveOccurred())
+
+		cfgPath = filepath.Join(dir, "janitor.yml")
+		baselinePath = filepath.Join(dir, "baseline.json")
+		Expect(ioutil.WriteFile(cfgPath, []byte("tracker: {}\n"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("only reports findings that aren't in the baseline", func() {
+		write("OLD= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\n")
+		Expect(run("-baseline", baselinePath, "-update-baseline")).To(BeEmpty())
+		Expect(baselinePath).To(BeARegularFile())
+
+		write("# moved down a line\nOLD= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\nNEW= Qw7eRt5yUi3oPa1sDf9gHj8kLz6xCv4bNm2\n")
+		findings := run("-baseline", baselinePath)
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Line).To(Equal(3))
+		Expect(findings[0].Fingerprint).NotTo(BeEmpty())
+	})
+
+	It("converges when the baseline is kept in the scanned tree", func() {
+		write("OLD= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\n")
+		Expect(run("-baseline", "baseline.json", "-update-baseline")).To(BeEmpty())
+		Expect(run("-baseline", "baseline.json")).To(BeEmpty())
+		Expect(run("-baseline", baselinePath, ".")).To(BeEmpty())
+	})
+
+	It("fails when the baseline doesn't exist", func() {
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Out: &bytes.Buffer{}}
+		Expect(t.Run([]string{"-cfg", cfgPath, "-baseline", filepath.Join(dir, "missing.json")})).To(Equal(1))
+	})
+
+	It("skips lines with an inline ignore", func() {
+		write("KEY= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku # janitor:ignore public test fixture\n")
+		Expect(run()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,77 @@
+package tracker
+
+import "strings"
+
+var (
+	base64Chars = charset(base64)
+	hexChars    = charset(hex)
+	// A hex string can never go above 4 bits of entropy, so it needs a threshold of its own
+	thresholds = map[string]float64{
+		"base64": base64Entropy,
+		"hex":    hexEntropy,
+	}
+)
+
+type candidate struct {
+	value   string
+	start   int
+	charset string
+}
+
+func (c candidate) end() int {
+	return c.start + len(c.value)
+}
+
+func charset(chars string) [256]bool {
+	var set [256]bool
+	for i := 0; i < len(chars); i++ {
+		set[chars[i]] = true
+	}
+	return set
+}
+
+// extractCandidates returns the maximal runs of base64 characters in the line, a run consisting only of
+// hex characters is a hex candidate. "=" is only allowed as padding at the end of a run
+func extractCandidates(line string) []candidate {
+	var candidates []candidate
+	for i := 0; i < len(line); {
+		if !base64Chars[line[i]] || line[i] == '=' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(line) && base64Chars[line[i]] && line[i] != '=' {
+			i++
+		}
+		for padding := 0; padding < 2 && i < len(line) && line[i] == '='; padding++ {
+			i++
+		}
+
+		if i-start < minCandidateLength {
+			continue
+		}
+
+		value := line[start:i]
+		c := candidate{value: value, start: start, charset: "base64"}
+		if isHex(value) {
+			c.charset = "hex"
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !hexChars[s[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// redactCandidate replaces the candidate in the line with its redacted version
+func redactCandidate(line string, c candidate) string {
+	return strings.TrimSpace(line[:c.start] + redact(c.value) + line[c.end():])
+}
@@ -0,0 +1,64 @@
+package tracker_test
+
+import (
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Candidates", func() {
+	var dir string
+
+	scan := func(content string) []tracker.Finding {
+		path := filepath.Join(dir, "settings.py")
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: &config.Tracker{}}
+		findings, err := t.FindAllPossibleKeys([]string{path})
+		Expect(err).NotTo(HaveOccurred())
+		return findings
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-candidates")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("extracts the secret without quotes and punctuation", func() {
+		findings := scan(`password="hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku";` + "\n")
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Secret).To(Equal("hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku"))
+		Expect(findings[0].Column).To(Equal(11))
+		Expect(findings[0].Length).To(Equal(35))
+		Expect(findings[0].Charset).To(Equal("base64"))
+		Expect(findings[0].Snippet).To(Equal(`password="hZ3k********";`))
+	})
+
+	It("keeps base64 padding but not the assignment", func() {
+		findings := scan("key: 'J4YV9RfP4ASxzhVwkphcDotymLq06SlfdXj5R1ebTzs='\n")
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Secret).To(Equal("J4YV9RfP4ASxzhVwkphcDotymLq06SlfdXj5R1ebTzs="))
+		Expect(findings[0].Column).To(Equal(7))
+	})
+
+	It("scores hex strings against their own threshold", func() {
+		findings := scan("sha = 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n")
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Charset).To(Equal("hex"))
+		Expect(findings[0].Entropy).To(BeNumerically("<", 4.5))
+	})
+
+	It("ignores low entropy runs", func() {
+		Expect(scan("import \"github.com/freddd/janitor/tracker/candidates\"\n")).To(BeEmpty())
+	})
+})
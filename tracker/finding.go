@@ -0,0 +1,97 @@
+package tracker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// entropyRule is used for findings that only have a high entropy and didn't match any rule
+const entropyRule string = "high-entropy"
+
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Vendors  []string `json:"vendors,omitempty"`
+	Severity string   `json:"severity"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	// Length is the length of the extracted candidate in bytes, Match is its redacted version
+	Length  int     `json:"length"`
+	Match   string  `json:"match"`
+	Charset string  `json:"charset"`
+	Entropy float64 `json:"entropy"`
+	Keyword string  `json:"keyword,omitempty"`
+	// Snippet is the line with the secret redacted
+	Snippet string `json:"snippet"`
+	Secret  string `json:"-"`
+	// RuleMatch is the text matched by the rule, which can be more than the candidate (e.g. xoxb-...)
+	RuleMatch    string  `json:"-"`
+	Commit       *Commit `json:"commit,omitempty"`
+	Verification string  `json:"verification,omitempty"`
+	// Fingerprint identifies the finding regardless of which line it's on
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// token is the credential to verify
+func (finding Finding) token() string {
+	if finding.RuleMatch != "" {
+		return finding.RuleMatch
+	}
+	return finding.Secret
+}
+
+func (finding Finding) fingerprint() string {
+	hash := sha256.New()
+	for _, part := range []string{finding.Rule, filepath.ToSlash(finding.File), finding.Secret} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+func redact(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", 8)
+	}
+	return secret[:4] + strings.Repeat("*", 8)
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 4
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
+
+// relativize makes the file paths relative to root, leaving paths outside of it untouched
+func relativize(findings []Finding, root string) {
+	for i := range findings {
+		rel, err := filepath.Rel(root, findings[i].File)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			findings[i].File = rel
+		}
+	}
+}
+
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
@@ -0,0 +1,218 @@
+package tracker
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/freddd/janitor/util"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const commitMarker string = "\x00commit "
+
+// The header of a hunk has a range per parent, a single one unless it's the combined diff of a merge, followed
+// by the range of the result. A range is the start and the count (1 if omitted)
+var hunkHeader = regexp.MustCompile(`^(@@@*)((?: -\d+(?:,\d+)?)+) \+(\d+)(?:,(\d+))? @@@*`)
+
+type Commit struct {
+	SHA    string    `json:"sha"`
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+}
+
+// FindAllPossibleKeysInHistory runs the secret detection on every line added by any commit reachable
+// from the refs of the repo, which also catches secrets that have since been removed from the tree. Merges
+// are diffed with --cc, so the lines that differ from every parent, like a resolved conflict, are scanned too
+func (tracker *Tracker) FindAllPossibleKeysInHistory(repoPath string) ([]Finding, error) {
+	if err := tracker.loadRules(); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", "-C", repoPath,
+		"-c", "core.quotePath=false",
+		"log", "--all", "--patch", "--cc", "--unified=0", "--no-color", "--no-renames", "--no-ext-diff",
+		"--format=%x00commit %H%x00%an <%ae>%x00%aI")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	findings, parseErr := tracker.processHistory(stdout, util.NewIgnore(tracker.Cfg.WhiteList))
+	// Drain whatever is left so git doesn't block on a full pipe
+	io.Copy(ioutil.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git log failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return findings, parseErr
+}
+
+// processHistory parses the output of git log --patch --cc --unified=0, a line can only be told apart from
+// a header by keeping track of how many lines are left in the current hunk
+func (tracker *Tracker) processHistory(r io.Reader, whitelist *util.Ignore) ([]Finding, error) {
+	scanner := newLineScanner(r)
+	var findings []Finding
+
+	var commit *Commit
+	path := ""
+	lineNumber := 0
+	var current *hunk
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if current != nil && !current.done() {
+			// "\ No newline at end of file" doesn't count towards the hunk
+			if strings.HasPrefix(line, "\\") {
+				continue
+			}
+			removed := current.removed(line)
+			if current.next(line) && path != "" {
+				findings = append(findings, tracker.processLine(path, lineNumber, line[len(current.parents):], commit)...)
+			}
+			if !removed {
+				lineNumber++
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, commitMarker):
+			parsed, err := parseCommit(strings.TrimPrefix(line, commitMarker))
+			if err != nil {
+				return findings, err
+			}
+			commit = parsed
+			path = ""
+		case strings.HasPrefix(line, "+++ "):
+			path = parsePath(strings.TrimPrefix(line, "+++ "))
+			if whitelist.MatchesPath(path) {
+				path = ""
+			}
+		case strings.HasPrefix(line, "@@"):
+			parsed, start, err := parseHunk(line)
+			if err != nil {
+				return findings, err
+			}
+			current = parsed
+			lineNumber = start
+		}
+	}
+
+	return findings, scanner.Err()
+}
+
+// hunk counts the lines left in the result and in every parent. A line has a column per parent: "+" is a line
+// of the result the parent doesn't have, "-" a line of the parent that isn't in the result
+type hunk struct {
+	result  int
+	parents []int
+}
+
+func parseHunk(line string) (*hunk, int, error) {
+	match := hunkHeader.FindStringSubmatch(line)
+	if match == nil || len(match[1]) != strings.Count(match[2], " -")+1 {
+		return nil, 0, fmt.Errorf("unable to parse hunk header: %s", line)
+	}
+	h := &hunk{result: parseCount(match[4])}
+	for _, parent := range strings.Fields(match[2]) {
+		count := ""
+		if i := strings.Index(parent, ","); i >= 0 {
+			count = parent[i+1:]
+		}
+		h.parents = append(h.parents, parseCount(count))
+	}
+	start, _ := strconv.Atoi(match[3])
+	return h, start, nil
+}
+
+func (h *hunk) done() bool {
+	if h.result > 0 {
+		return false
+	}
+	for _, left := range h.parents {
+		if left > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *hunk) removed(line string) bool {
+	return strings.Contains(h.columns(line), "-")
+}
+
+func (h *hunk) columns(line string) string {
+	if len(line) < len(h.parents) {
+		return line
+	}
+	return line[:len(h.parents)]
+}
+
+// next counts the line off and reports whether it was added by the commit, it's in the result and none of
+// the parents has it. Lines of a merge that come from one of the parents were scanned in their own commit
+func (h *hunk) next(line string) bool {
+	columns := h.columns(line)
+	if h.removed(line) {
+		for i, column := range columns {
+			if column == '-' {
+				h.parents[i]--
+			}
+		}
+		return false
+	}
+	h.result--
+	for i, column := range columns {
+		if column == ' ' {
+			h.parents[i]--
+		}
+	}
+	return len(columns) == len(h.parents) && strings.Count(columns, "+") == len(h.parents)
+}
+
+func parseCommit(s string) (*Commit, error) {
+	fields := strings.Split(s, "\x00")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unable to parse commit: %q", s)
+	}
+
+	date, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Commit{SHA: fields[0], Author: fields[1], Date: date}, nil
+}
+
+// parsePath returns the path of the new file in a "+++" header, or "" if the file was deleted
+func parsePath(s string) string {
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "\"") {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			s = unquoted
+		}
+	}
+	return strings.TrimPrefix(s, "b/")
+}
+
+func parseCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	count, _ := strconv.Atoi(s)
+	return count
+}
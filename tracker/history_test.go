@@ -0,0 +1,122 @@
+package tracker_test
+
+import (
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const secret = "hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku"
+
+var _ = Describe("History", func() {
+	var repo string
+
+	command := func(args ...string) *exec.Cmd {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.com",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+repo)
+		return cmd
+	}
+
+	git := func(args ...string) string {
+		out, err := command(args...).CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	BeforeEach(func() {
+		var err error
+		repo, err = ioutil.TempDir("", "janitor-history")
+		Expect(err).NotTo(HaveOccurred())
+		git("init", "-q")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(repo)
+	})
+
+	It("finds secrets that were committed and later removed", func() {
+		Expect(ioutil.WriteFile(filepath.Join(repo, "settings.conf"), []byte("name = janitor\npassword = "+secret+"\n"), 0644)).To(Succeed())
+		git("add", "settings.conf")
+		git("commit", "-q", "-m", "add settings")
+		leaked := git("rev-parse", "HEAD")
+
+		Expect(ioutil.WriteFile(filepath.Join(repo, "settings.conf"), []byte("name = janitor\n"), 0644)).To(Succeed())
+		git("commit", "-q", "-am", "remove password")
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: &config.Tracker{Keywords: []string{"password"}}}
+		findings, err := t.FindAllPossibleKeysInHistory(repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Commit.SHA).To(Equal(leaked))
+		Expect(findings[0].Commit.Author).To(Equal("Jane Doe <jane@example.com>"))
+		Expect(findings[0].File).To(Equal("settings.conf"))
+		Expect(findings[0].Line).To(Equal(2))
+		Expect(findings[0].Keyword).To(Equal("password"))
+	})
+
+	It("scans the lines a merge adds while resolving a conflict", func() {
+		write := func(content string) {
+			Expect(ioutil.WriteFile(filepath.Join(repo, "settings.conf"), []byte(content), 0644)).To(Succeed())
+		}
+		write("name = janitor\n")
+		git("add", "settings.conf")
+		git("commit", "-q", "-m", "add settings")
+		base := git("rev-parse", "--abbrev-ref", "HEAD")
+
+		git("checkout", "-q", "-b", "other")
+		write("name = other\n")
+		git("commit", "-q", "-am", "rename on other")
+		git("checkout", "-q", base)
+		write("name = ours\n")
+		git("commit", "-q", "-am", "rename on base")
+
+		// conflicts
+		Expect(command("merge", "-q", "other").Run()).NotTo(Succeed())
+		write("name = ours\npassword = " + secret + "\n")
+		git("commit", "-q", "-am", "merge other")
+		merge := git("rev-parse", "HEAD")
+		Expect(git("rev-list", "--merges", "HEAD")).To(Equal(merge))
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: &config.Tracker{Keywords: []string{"password"}}}
+		findings, err := t.FindAllPossibleKeysInHistory(repo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Commit.SHA).To(Equal(merge))
+		Expect(findings[0].Line).To(Equal(2))
+	})
+
+	It("keeps going past lines longer than the max line length", func() {
+		minified := strings.Repeat("var a=1;", 200*1024)
+		Expect(ioutil.WriteFile(filepath.Join(repo, "bundle.js"), []byte(minified+"\n"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repo, "settings.conf"), []byte("password = "+secret+"\n"), 0644)).To(Succeed())
+		git("add", "bundle.js", "settings.conf")
+		git("commit", "-q", "-m", "add bundle")
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: &config.Tracker{Keywords: []string{"password"}}}
+		findings, err := t.FindAllPossibleKeysInHistory(repo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].File).To(Equal("settings.conf"))
+	})
+
+	It("fails when the path is not a git repo", func() {
+		dir, err := ioutil.TempDir("", "janitor-history")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: &config.Tracker{}}
+		_, err = t.FindAllPossibleKeysInHistory(dir)
+		Expect(err).To(HaveOccurred())
+	})
+})
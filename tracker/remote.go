@@ -0,0 +1,111 @@
+package tracker
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/freddd/janitor/util"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRemoteTimeout       = 30 * time.Second
+	defaultRemoteMaxSize int64 = 10 * 1024 * 1024
+)
+
+func isUrl(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// processUrl scans the body of the url the same way as a file, a body above remote.maxSize is an error
+func (tracker *Tracker) processUrl(target string) ([]Finding, error) {
+	timeout, maxSize := tracker.remoteLimits()
+	client := tracker.Client
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+
+	res, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: got status code %d", target, res.StatusCode)
+	}
+	if res.ContentLength > maxSize {
+		return nil, fmt.Errorf("%s: exceeds the size limit of %d bytes", target, maxSize)
+	}
+
+	return tracker.processReader(target, limit(target, res.Body, maxSize), 0)
+}
+
+func (tracker *Tracker) remoteLimits() (time.Duration, int64) {
+	timeout := defaultRemoteTimeout
+	maxSize := defaultRemoteMaxSize
+	if tracker.Cfg != nil {
+		if tracker.Cfg.Remote.Timeout != 0 {
+			timeout = tracker.Cfg.Remote.Timeout
+		}
+		if tracker.Cfg.Remote.MaxSize != 0 {
+			maxSize = tracker.Cfg.Remote.MaxSize
+		}
+	}
+	return timeout, maxSize
+}
+
+// expandTargets keeps urls and files as they are and walks folders, a target that can't be expanded doesn't
+// stop the others
+func (tracker *Tracker) expandTargets(targets []string) ([]string, error) {
+	var files []string
+	var errs []string
+	for _, target := range targets {
+		if isUrl(target) {
+			files = append(files, target)
+			continue
+		}
+
+		info, err := os.Stat(target)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, target)
+			continue
+		}
+
+		found, err := util.FindAllFiles(target, tracker.Cfg.WhiteList)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		files = append(files, found...)
+	}
+	return files, joinErrors(errs)
+}
+
+// readUrls reads one url per line, blank lines and lines starting with # are skipped
+func readUrls(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isUrl(line) {
+			return nil, fmt.Errorf("%s: not a http(s) url: %s", path, line)
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
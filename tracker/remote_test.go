@@ -0,0 +1,132 @@
+package tracker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Remote", func() {
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/bundle.js", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "var a=1;\nvar config={apiKey:\"hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\"};\n")
+		})
+		mux.HandleFunc("/large.js", func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, strings.Repeat("a", 4096))
+		})
+		mux.HandleFunc("/slow.js", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	scan := func(cfg *config.Tracker, targets ...string) ([]tracker.Finding, string) {
+		ui := cli.NewMockUi()
+		t := &tracker.Tracker{Ui: ui, Cfg: cfg}
+		findings, err := t.FindAllPossibleKeys(targets)
+		Expect(err).NotTo(HaveOccurred())
+		return findings, ui.ErrorWriter.String()
+	}
+
+	It("scans the body of a url", func() {
+		findings, errors := scan(&config.Tracker{}, server.URL+"/bundle.js")
+		Expect(errors).To(BeEmpty())
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].File).To(Equal(server.URL + "/bundle.js"))
+		Expect(findings[0].Line).To(Equal(2))
+		Expect(findings[0].Column).To(Equal(21))
+	})
+
+	It("reports urls that can't be fetched", func() {
+		_, errors := scan(&config.Tracker{}, server.URL+"/missing.js")
+		Expect(errors).To(ContainSubstring("missing.js: got status code 404"))
+	})
+
+	It("caps the size of the body", func() {
+		_, errors := scan(&config.Tracker{Remote: config.Remote{MaxSize: 1024}}, server.URL+"/large.js")
+		Expect(errors).To(ContainSubstring("exceeds the size limit of 1024 bytes"))
+	})
+
+	It("times out", func() {
+		_, errors := scan(&config.Tracker{Remote: config.Remote{Timeout: 50 * time.Millisecond}}, server.URL+"/slow.js")
+		Expect(errors).To(ContainSubstring("slow.js"))
+	})
+
+	It("reads targets from the command line and a file of urls", func() {
+		dir, err := ioutil.TempDir("", "janitor-remote")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		cfgPath := filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(cfgPath, []byte("tracker:\n  keywords:\n    - apikey\n"), 0644)).To(Succeed())
+		urlsPath := filepath.Join(dir, "urls.txt")
+		Expect(ioutil.WriteFile(urlsPath, []byte("# bundles\n"+server.URL+"/bundle.js\n\n"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "local.env"), []byte("KEY=Qw7eRt5yUi3oPa1sDf9gHj8kLz6xCv4bNm2\n"), 0644)).To(Succeed())
+
+		out := &bytes.Buffer{}
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Out: out}
+		Expect(t.Run([]string{"-cfg", cfgPath, "-format", "json", "-urls-file", urlsPath, filepath.Join(dir, "local.env")})).To(Equal(0))
+
+		var findings []tracker.Finding
+		Expect(json.Unmarshal(out.Bytes(), &findings)).To(Succeed())
+		Expect(findings).To(HaveLen(2))
+		Expect(findings[0].File).To(Equal(filepath.Join(dir, "local.env")))
+		Expect(findings[1].File).To(Equal(server.URL + "/bundle.js"))
+		Expect(findings[1].Keyword).To(Equal("apikey"))
+	})
+
+	It("fails when a target can't be expanded or fetched", func() {
+		dir, err := ioutil.TempDir("", "janitor-remote")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		cfgPath := filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(cfgPath, []byte("tracker: {}\n"), 0644)).To(Succeed())
+		local := filepath.Join(dir, "local.env")
+		Expect(ioutil.WriteFile(local, []byte("KEY=Qw7eRt5yUi3oPa1sDf9gHj8kLz6xCv4bNm2\n"), 0644)).To(Succeed())
+
+		run := func(args ...string) (int, []tracker.Finding, string) {
+			out := &bytes.Buffer{}
+			ui := cli.NewMockUi()
+			t := &tracker.Tracker{Ui: ui, Out: out}
+			code := t.Run(append([]string{"-cfg", cfgPath, "-format", "json"}, args...))
+			var findings []tracker.Finding
+			Expect(json.Unmarshal(out.Bytes(), &findings)).To(Succeed())
+			return code, findings, ui.ErrorWriter.String()
+		}
+
+		code, findings, errors := run(filepath.Join(dir, "does-not-exist"), local)
+		Expect(code).To(Equal(1))
+		Expect(findings).To(HaveLen(1))
+		Expect(errors).To(ContainSubstring("does-not-exist: no such file or directory"))
+
+		urlsPath := filepath.Join(dir, "urls.txt")
+		Expect(ioutil.WriteFile(urlsPath, []byte(server.URL+"/missing.js\n"), 0644)).To(Succeed())
+		code, _, errors = run("-urls-file", urlsPath, local)
+		Expect(code).To(Equal(1))
+		Expect(errors).To(ContainSubstring("missing.js: got status code 404"))
+
+		code, _, _ = run(local)
+		Expect(code).To(Equal(0))
+	})
+})
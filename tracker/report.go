@@ -0,0 +1,200 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const sarifSchema string = "https://json.schemastore.org/sarif-2.1.0.json"
+
+var renderers = map[string]func(tracker *Tracker, findings []Finding) error{
+	"text":  renderText,
+	"json":  renderJSON,
+	"sarif": renderSARIF,
+}
+
+func (tracker *Tracker) out() io.Writer {
+	if tracker.Out == nil {
+		return os.Stdout
+	}
+	return tracker.Out
+}
+
+func renderText(tracker *Tracker, findings []Finding) error {
+	tracker.Ui.Info("---------- Finding secrets: ------------------------------")
+	for _, finding := range findings {
+		tracker.Ui.Info("----------------------------------------------------------")
+		if finding.Rule != entropyRule {
+			tracker.Ui.Info(fmt.Sprintf("Matched rule: %s (%s)", finding.Rule, finding.Severity))
+		}
+		for _, vendor := range finding.Vendors {
+			if vendor != finding.Rule {
+				tracker.Ui.Info(fmt.Sprintf("Matched vendor: %s", vendor))
+			}
+		}
+		if finding.Keyword != "" {
+			tracker.Ui.Info(fmt.Sprintf("Matched keyword: %s", finding.Keyword))
+		}
+		if finding.Commit != nil {
+			tracker.Ui.Info(fmt.Sprintf("Commit: %s", finding.Commit.SHA))
+			tracker.Ui.Info(fmt.Sprintf("Author: %s", finding.Commit.Author))
+			tracker.Ui.Info(fmt.Sprintf("Date: %s", finding.Commit.Date.Format(time.RFC3339)))
+		}
+		tracker.Ui.Info(fmt.Sprintf("File: %s", finding.File))
+		tracker.Ui.Info(fmt.Sprintf("Line: %d", finding.Line))
+		tracker.Ui.Info(fmt.Sprintf("Column: %d", finding.Column))
+		tracker.Ui.Info(fmt.Sprintf("Match: %s (%s, %d chars)", finding.Match, finding.Charset, finding.Length))
+		tracker.Ui.Info(fmt.Sprintf("Entropy: %f", finding.Entropy))
+		tracker.Ui.Info(fmt.Sprintf("Text: %s", finding.Snippet))
+		if finding.Verification != "" {
+			tracker.Ui.Info(fmt.Sprintf("Verification: %s", finding.Verification))
+		}
+	}
+	tracker.Ui.Info("----------------------------------------------------------")
+	return nil
+}
+
+func renderJSON(tracker *Tracker, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	encoder := json.NewEncoder(tracker.out())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(findings)
+}
+
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+func renderSARIF(tracker *Tracker, findings []Finding) error {
+	driver := sarifDriver{Name: "janitor", InformationURI: "https://github.com/freddd/janitor", Rules: []sarifRule{}}
+	results := []sarifResult{}
+	seen := map[string]bool{}
+
+	for _, finding := range findings {
+		if !seen[finding.Rule] {
+			seen[finding.Rule] = true
+			driver.Rules = append(driver.Rules, sarifRule{
+				ID:                   finding.Rule,
+				ShortDescription:     sarifMessage{Text: describeRule(finding.Rule)},
+				DefaultConfiguration: sarifConfiguration{Level: sarifLevel(finding.Severity)},
+			})
+		}
+
+		properties := map[string]interface{}{"entropy": finding.Entropy, "charset": finding.Charset}
+		if finding.Keyword != "" {
+			properties["keyword"] = finding.Keyword
+		}
+		if finding.Commit != nil {
+			properties["commit"] = finding.Commit
+		}
+		if finding.Verification != "" {
+			properties["verification"] = finding.Verification
+		}
+
+		result := sarifResult{
+			RuleID:  finding.Rule,
+			Level:   sarifLevel(finding.Severity),
+			Message: sarifMessage{Text: fmt.Sprintf("Possible secret: %s", finding.Snippet)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(finding.File)},
+				Region:           sarifRegion{StartLine: finding.Line, StartColumn: finding.Column, EndColumn: finding.Column + finding.Length},
+			}}},
+			Properties: properties,
+		}
+		if finding.Fingerprint != "" {
+			result.PartialFingerprints = map[string]string{"janitor/v1": finding.Fingerprint}
+		}
+		results = append(results, result)
+	}
+
+	encoder := json.NewEncoder(tracker.out())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
+
+func describeRule(rule string) string {
+	if rule == entropyRule {
+		return "High entropy string that might be a secret"
+	}
+	return fmt.Sprintf("Possible %s secret", rule)
+}
+
+func sarifLevel(severity string) string {
+	switch severity {
+	case "critical", "high":
+		return "error"
+	case "medium":
+		return "warning"
+	}
+	return "note"
+}
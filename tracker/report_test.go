@@ -0,0 +1,95 @@
+package tracker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Report", func() {
+	var dir string
+	var cfgPath string
+
+	run := func(format string) (*bytes.Buffer, *cli.MockUi) {
+		out := &bytes.Buffer{}
+		ui := cli.NewMockUi()
+		t := &tracker.Tracker{Ui: ui, Out: out}
+
+		wd, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Chdir(dir)).To(Succeed())
+		defer os.Chdir(wd)
+
+		Expect(t.Run([]string{"-cfg", cfgPath, "-format", format})).To(Equal(0))
+		return out, ui
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-report")
+		Expect(err).NotTo(HaveOccurred())
+		dir, err = filepath.EvalSymlinks(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte("PASSWORD= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\n"), 0644)).To(Succeed())
+		cfgPath = filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(cfgPath, []byte("tracker:\n  keywords:\n    - password\n"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("renders json without leaking the secret", func() {
+		out, ui := run("json")
+		Expect(ui.OutputWriter.String()).To(BeEmpty())
+
+		var findings []map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &findings)).To(Succeed())
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0]["file"]).To(Equal("app.env"))
+		Expect(findings[0]["line"]).To(BeEquivalentTo(1))
+		Expect(findings[0]["column"]).To(BeEquivalentTo(11))
+		Expect(findings[0]["keyword"]).To(Equal("password"))
+		Expect(findings[0]["snippet"]).To(Equal("PASSWORD= hZ3k********"))
+		Expect(out.String()).NotTo(ContainSubstring("hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku"))
+	})
+
+	It("renders sarif", func() {
+		out, _ := run("sarif")
+
+		var log struct {
+			Version string `json:"version"`
+			Runs    []struct {
+				Results []struct {
+					RuleID    string `json:"ruleId"`
+					Locations []struct {
+						PhysicalLocation struct {
+							ArtifactLocation struct {
+								URI string `json:"uri"`
+							} `json:"artifactLocation"`
+						} `json:"physicalLocation"`
+					} `json:"locations"`
+				} `json:"results"`
+			} `json:"runs"`
+		}
+		Expect(json.Unmarshal(out.Bytes(), &log)).To(Succeed())
+		Expect(log.Version).To(Equal("2.1.0"))
+		Expect(log.Runs[0].Results).To(HaveLen(1))
+		Expect(log.Runs[0].Results[0].RuleID).To(Equal("high-entropy"))
+		Expect(log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI).To(Equal("app.env"))
+	})
+
+	It("renders text through the ui", func() {
+		out, ui := run("text")
+		Expect(out.String()).To(BeEmpty())
+		Expect(ui.OutputWriter.String()).To(ContainSubstring("File: app.env"))
+		Expect(ui.OutputWriter.String()).To(ContainSubstring("Matched keyword: password"))
+	})
+})
@@ -0,0 +1,119 @@
+package tracker
+
+import (
+	"github.com/freddd/janitor/config"
+	"regexp"
+	"strings"
+)
+
+const defaultSeverity string = "medium"
+
+// BuiltinRules are always used unless disabled or replaced by a rule with the same name in the config.
+// The keyword of a built-in rule is the vendor name, i.e. the vendor has to be mentioned on the same line
+var BuiltinRules = []config.Rule{
+	{Name: "aws", Regexps: []string{"[0-9a-zA-Z/+]{40}"}, Keyword: "aws", Severity: "high"},
+	// Not a secret on its own, but needed to verify an aws secret. The id is too short to pass the base64 threshold
+	{Name: "aws-access-key-id", Regexps: []string{"(AKIA|ASIA)[0-9A-Z]{16}"}, Severity: "low", Entropy: entropyOverride(3.0)},
+	{Name: "bitly", Regexps: []string{"R_[0-9a-f]{32}"}, Keyword: "bitly", Severity: "low"},
+	{Name: "facebook", Regexps: []string{"[0-9a-f]{32}"}, Keyword: "facebook", Severity: "low"},
+	{Name: "flickr", Regexps: []string{"[0-9a-f]{16}"}, Keyword: "flickr", Severity: "low"},
+	{Name: "foursquare", Regexps: []string{"[0-9A-Z]{48}"}, Keyword: "foursquare", Severity: "low"},
+	// "linkedin": "[0-9a-zA-Z]{16}", This regexp basically catches everything
+	{Name: "twitter", Regexps: []string{"[0-9a-zA-Z]{35,44}"}, Keyword: "twitter", Severity: "low"},
+	{Name: "google", Regexps: []string{"(AIza.{35})"}, Keyword: "google", Severity: "medium"},
+	{Name: "mailchimp", Regexps: []string{"[0-9a-z]{32}(-us[12])?"}, Keyword: "mailchimp", Severity: "medium"},
+	{Name: "github", Regexps: []string{"[0-9A-F]{40}"}, Keyword: "github", Severity: "high"},
+	// The dashes split a token into candidates, only the last part of 24 chars is long enough and it can't reach the
+	// base64 threshold
+	{Name: "slack", Regexps: []string{"xoxb-[0-9a-zA-Z-]{10,}", "xoxp-[0-9a-zA-Z-]{10,}", "xoxa-[0-9a-zA-Z-]{10,}"}, Keyword: "slack", Severity: "high", Entropy: entropyOverride(3.5)},
+	{Name: "ssh", Regexps: []string{"ssh-rsa AAAA[0-9A-Za-z+/]+[=]{0,3}( [^@]+@[^@]+)?"}, Keyword: "ssh", Severity: "medium"},
+}
+
+type rule struct {
+	name     string
+	regexps  []*regexp.Regexp
+	keyword  string
+	severity string
+	// entropy overrides the threshold of the charset when set
+	entropy *float64
+}
+
+// ruleMatch is the position of a match of the rule in a line
+type ruleMatch struct {
+	rule
+	start int
+	end   int
+}
+
+func (match ruleMatch) overlaps(c candidate) bool {
+	return match.start < c.end() && c.start < match.end
+}
+
+// compileRules merges the built-in rules with the ones from the config, the config is expected to have
+// passed config.Validate
+func compileRules(cfg *config.Tracker) ([]rule, error) {
+	disabled := map[string]bool{}
+	for _, name := range cfg.DisabledRules {
+		disabled[name] = true
+	}
+
+	overridden := map[string]bool{}
+	for _, r := range cfg.Rules {
+		overridden[r.Name] = true
+	}
+
+	var merged []config.Rule
+	for _, r := range BuiltinRules {
+		if !overridden[r.Name] {
+			merged = append(merged, r)
+		}
+	}
+	merged = append(merged, cfg.Rules...)
+
+	var rules []rule
+	for _, r := range merged {
+		if disabled[r.Name] {
+			continue
+		}
+
+		compiled := rule{
+			name:     r.Name,
+			keyword:  strings.ToLower(r.Keyword),
+			severity: r.Severity,
+			entropy:  r.Entropy,
+		}
+		if compiled.severity == "" {
+			compiled.severity = defaultSeverity
+		}
+
+		for _, expr := range r.Regexps {
+			regex, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, err
+			}
+			compiled.regexps = append(compiled.regexps, regex)
+		}
+		rules = append(rules, compiled)
+	}
+
+	return rules, nil
+}
+
+// find returns every match of the regexps in the line, none if the keyword (if any) isn't in the line
+func (r rule) find(line string, lowerLine string) []ruleMatch {
+	if r.keyword != "" && !strings.Contains(lowerLine, r.keyword) {
+		return nil
+	}
+
+	var matches []ruleMatch
+	for _, regex := range r.regexps {
+		for _, loc := range regex.FindAllStringIndex(line, -1) {
+			matches = append(matches, ruleMatch{rule: r, start: loc[0], end: loc[1]})
+		}
+	}
+	return matches
+}
+
+func entropyOverride(value float64) *float64 {
+	return &value
+}
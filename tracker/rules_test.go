@@ -0,0 +1,71 @@
+package tracker_test
+
+import (
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Rules", func() {
+	var dir string
+
+	scan := func(cfg *config.Tracker, content string) []tracker.Finding {
+		path := filepath.Join(dir, "app.env")
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: cfg}
+		findings, err := t.FindAllPossibleKeys([]string{path})
+		Expect(err).NotTo(HaveOccurred())
+		return findings
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-rules")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("uses rules from the config with their entropy override", func() {
+		entropy := 0.5
+		cfg := &config.Tracker{Rules: []config.Rule{
+			{Name: "internal", Regexps: []string{"itk_[0-9a-f]{32}"}, Severity: "critical", Entropy: &entropy},
+		}}
+
+		Expect(scan(&config.Tracker{}, "TOKEN= itk_abababababababababababababababab\n")).To(BeEmpty())
+
+		findings := scan(cfg, "TOKEN= itk_abababababababababababababababab\n")
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Rule).To(Equal("internal"))
+		Expect(findings[0].Severity).To(Equal("critical"))
+		Expect(findings[0].Column).To(Equal(12))
+	})
+
+	It("honours the required keyword", func() {
+		entropy := 0.5
+		cfg := &config.Tracker{Rules: []config.Rule{
+			{Name: "internal", Regexps: []string{"itk_[0-9a-f]{32}"}, Keyword: "Internal", Entropy: &entropy},
+		}}
+
+		Expect(scan(cfg, "TOKEN= itk_abababababababababababababababab\n")).To(BeEmpty())
+
+		findings := scan(cfg, "INTERNAL_TOKEN= itk_abababababababababababababababab\n")
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].Rule).To(Equal("internal"))
+		Expect(findings[0].Severity).To(Equal("medium"))
+	})
+
+	It("does not use disabled built-in rules", func() {
+		line := "twitter_secret= Zt8pQ2mK9xWv4LbN7cRj3Hf6Gs1Ye5Da0Uo\n"
+		Expect(scan(&config.Tracker{}, line)[0].Vendors).To(ContainElement("twitter"))
+		Expect(scan(&config.Tracker{DisabledRules: []string{"twitter"}}, line)[0].Vendors).NotTo(ContainElement("twitter"))
+	})
+})
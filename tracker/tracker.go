@@ -2,91 +2,233 @@ package tracker
 
 import (
 	"bufio"
-	"errors"
 	"flag"
 	"fmt"
 	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/util"
 	"github.com/mitchellh/cli"
+	"io"
 	"math"
+	"net/http"
 	"os"
-	"regexp"
-	"strings"
-	"github.com/freddd/janitor/util"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 )
 
 const (
-	base64 string = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
-	hex    string = "1234567890abcdefABCDEF"
-	minimumEntropy float64 = 4.8
+	base64        string  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+	hex           string  = "1234567890abcdefABCDEF"
+	base64Entropy float64 = 4.5
+	hexEntropy    float64 = 3.0
+	// Shorter strings don't carry enough entropy to reach the thresholds
+	minCandidateLength int = 20
+	maxLineLength      int = 1024 * 1024
+	// ignoreComment suppresses every finding on the line it's on
+	ignoreComment string = "janitor:ignore"
 )
 
-var keys = map[string][]*regexp.Regexp{
-	"aws":        {regexp.MustCompile("[0-9a-zA-Z/+]{40}")},
-	"bitly":      {regexp.MustCompile("R_[0-9a-f]{32}")},
-	"facebook":   {regexp.MustCompile("[0-9a-f]{32}")},
-	"flickr":     {regexp.MustCompile("[0-9a-f]{16}")},
-	"foursquare": {regexp.MustCompile("[0-9A-Z]{48}")},
-	// "linkedin":{regexp.MustCompile("[0-9a-zA-Z]{16}")}, This regexp basically catches everything
-	"twitter":   {regexp.MustCompile("[0-9a-zA-Z]{35,44}")},
-	"google":    {regexp.MustCompile("(AIza.{35})")},
-	"mailchimp": {regexp.MustCompile("[0-9a-z]{32}(-us[12])?")},
-	"github":    {regexp.MustCompile("[0-9A-F]{40}")},
-	"slack":     {regexp.MustCompile("^xoxb-"), regexp.MustCompile("^xoxp-"), regexp.MustCompile("^xoxa-")},
-	"ssh":       {regexp.MustCompile("ssh-rsa AAAA[0-9A-Za-z+/]+[=]{0,3}( [^@]+@[^@]+)?")},
-}
-
 type Tracker struct {
 	Cfg *config.Tracker
 	Ui  cli.Ui
+	// Out receives the rendered findings, defaults to stdout
+	Out io.Writer
+	// Workers is the number of files scanned concurrently, defaults to GOMAXPROCS
+	Workers int
+	// Verifiers are keyed by rule name, defaults to DefaultVerifiers
+	Verifiers map[string]Verifier
+	// Client fetches urls, defaults to a client using remote.timeout from the config
+	Client *http.Client
+	rules  []rule
+	// unread counts the files, urls and archive entries of the last scan that couldn't be read
+	unread int
+	// skipped are the nested archives of the last scan that were past the max depth, the workers add them
+	skipped      []string
+	skippedMutex sync.Mutex
 }
 
 func (tracker *Tracker) Run(args []string) int {
 	cmdFlags := flag.NewFlagSet("cfg", flag.ExitOnError)
 	cmdFlags.Usage = func() { tracker.Ui.Output(tracker.Help()) }
 	cfgPath := ""
+	history := false
+	format := ""
+	baselinePath := ""
+	updateBaseline := false
+	verify := false
+	urlsFile := ""
 	cmdFlags.StringVar(&cfgPath, "cfg", "", "Path to the config")
+	cmdFlags.BoolVar(&history, "history", false, "Scan every commit reachable from all refs")
+	cmdFlags.StringVar(&format, "format", "text", "The output format: text, json or sarif")
+	cmdFlags.StringVar(&baselinePath, "baseline", "", "Path to the baseline of accepted findings")
+	cmdFlags.BoolVar(&updateBaseline, "update-baseline", false, "Write the current findings to the baseline")
+	cmdFlags.BoolVar(&verify, "verify", false, "Check if the found credentials are live")
+	cmdFlags.StringVar(&urlsFile, "urls-file", "", "File with one url to scan per line")
+	cmdFlags.IntVar(&tracker.Workers, "workers", runtime.GOMAXPROCS(0), "Number of files scanned concurrently")
 
-	if len(args) < 1 {
-		cmdFlags.Usage()
+	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	if err := cmdFlags.Parse(args); err != nil {
+	render, ok := renderers[format]
+	if !ok {
+		tracker.Ui.Error(fmt.Sprintf("Unknown format: %s", format))
 		return 1
 	}
+	if updateBaseline && baselinePath == "" {
+		tracker.Ui.Error("-update-baseline requires -baseline")
+		return 1
+	}
+	// Only the findings should end up on stdout when the output is meant for machines
+	info := func(message string) {
+		if format == "text" {
+			tracker.Ui.Info(message)
+		}
+	}
 
-	cfg, err := config.LoadConfig(cfgPath)
+	cfg, err := config.LoadDefaultConfig(cfgPath, "tracker")
 	if err != nil {
 		tracker.Ui.Error(err.Error())
 		return 1
 	}
 	tracker.Cfg = &cfg.Tracker
 
-	pathToRepo, err := util.CurrentDir()
-	if err != nil {
-		tracker.Ui.Error(err.Error())
-		return 1
+	// A target that couldn't be scanned fails the run after the findings are reported, a typo mustn't look
+	// like a clean scan
+	incomplete := false
+	var findings []Finding
+	if history {
+		pathToRepo := tracker.Cfg.RepoPath
+		if pathToRepo == "" {
+			pathToRepo, err = util.CurrentDir()
+			if err != nil {
+				tracker.Ui.Error(err.Error())
+				return 1
+			}
+		}
+
+		info(fmt.Sprintf("Running on history of: %s", pathToRepo))
+		findings, err = tracker.FindAllPossibleKeysInHistory(pathToRepo)
+		if err != nil {
+			tracker.Ui.Error(err.Error())
+			return 1
+		}
+		if baselinePath != "" {
+			findings = withoutBaselineHistory(findings, pathToRepo, baselinePath)
+		}
+	} else {
+		pathToRepo, err := util.CurrentDir()
+		if err != nil {
+			tracker.Ui.Error(err.Error())
+			return 1
+		}
+
+		targets := cmdFlags.Args()
+		if urlsFile != "" {
+			urls, err := readUrls(urlsFile)
+			if err != nil {
+				tracker.Ui.Error(err.Error())
+				return 1
+			}
+			targets = append(targets, urls...)
+		}
+
+		var files []string
+		if len(targets) == 0 {
+			info(fmt.Sprintf("Running on path: %s", pathToRepo))
+			files, err = util.FindAllFiles(pathToRepo, tracker.Cfg.WhiteList)
+		} else {
+			info(fmt.Sprintf("Running on: %s", strings.Join(targets, ", ")))
+			files, err = tracker.expandTargets(targets)
+		}
+		if err != nil {
+			tracker.Ui.Error(err.Error())
+			incomplete = true
+		}
+		if baselinePath != "" {
+			files = withoutBaseline(files, baselinePath)
+		}
+
+		findings, err = tracker.FindAllPossibleKeys(files)
+		if err != nil {
+			tracker.Ui.Error(err.Error())
+			return 1
+		}
+		if tracker.unread > 0 {
+			incomplete = true
+		}
+		relativize(findings, pathToRepo)
 	}
 
-	tracker.Ui.Info(fmt.Sprintf("Running on path: %s", pathToRepo))
-	files, err := util.FindAllFiles(pathToRepo, []string{})
-	if err != nil {
-		tracker.Ui.Error(err.Error())
+	for i := range findings {
+		findings[i].Fingerprint = findings[i].fingerprint()
 	}
 
-	tracker.Ui.Info("---------- Finding secrets: ------------------------------")
-	tracker.FindAllPossibleKeys(files)
-	tracker.Ui.Info("----------------------------------------------------------")
+	if updateBaseline {
+		if incomplete {
+			tracker.Ui.Error("Not writing the baseline, some targets couldn't be scanned")
+			return 1
+		}
+		if err := writeBaseline(baselinePath, findings); err != nil {
+			tracker.Ui.Error(err.Error())
+			return 1
+		}
+		info(fmt.Sprintf("Wrote %d findings to the baseline: %s", len(findings), baselinePath))
+		return 0
+	}
+
+	if baselinePath != "" {
+		baseline, err := readBaseline(baselinePath)
+		if err != nil {
+			tracker.Ui.Error(err.Error())
+			return 1
+		}
+		findings = baseline.filter(findings)
+	}
+
+	if verify {
+		if tracker.Verifiers == nil {
+			tracker.Verifiers = DefaultVerifiers(tracker.Cfg.Verify)
+		}
+		tracker.verify(findings)
+	}
+
+	if err := render(tracker, findings); err != nil {
+		tracker.Ui.Error(err.Error())
+		return 1
+	}
+	if incomplete {
+		return 1
+	}
 	return 0
 }
 
 func (tracker *Tracker) Help() string {
 	helpText := `
-		Usage: janitor tracker
-		  Recursively searches for secrets in the current folder
+		Usage: janitor tracker [options] [path or url ...]
+		  Recursively searches for secrets in the current folder, or in the given files, folders and urls
 		Options:
-		  -cfg  the global config file (mandatory)
+		  -cfg      the global config file, defaults to ./.janitor.yml or $XDG_CONFIG_HOME/janitor/config.yml
+		            and the built-in rules are used without one. Files matching the whitelist or any
+		            .gitignore/.janitorignore are skipped, as are binary files
+		  -history  scan every commit reachable from all refs of the repo at repoPath
+		            (defaults to the current folder) instead of the working tree, merges are scanned for
+		            the lines that differ from every parent, like a resolved conflict
+		  -format   the output format: text (default), json or sarif
+		  -workers  number of files scanned concurrently (defaults to the number of CPUs)
+		  -baseline path to a json file of accepted findings, only new findings are reported. The baseline
+		            itself isn't scanned
+		  -update-baseline
+		            write all current findings to the baseline instead of reporting them
+		  -urls-file
+		            file with one url to scan per line, urls are fetched using remote.timeout and
+		            remote.maxSize from the config
+		  -verify   call the apis of the vendors to tag findings as verified, invalid or unknown
+		The findings are reported even if a file, url or archive entry can't be read, but the exit code is 1.
+		A line containing janitor:ignore is never reported. Archives (zip, jar, tar, gzip, bzip2, ...) are
+		scanned entry by entry and reported as archive.jar!/path/in/archive.
 		`
 
 	return strings.TrimSpace(helpText)
@@ -96,63 +238,230 @@ func (tracker *Tracker) Synopsis() string {
 	return "Recursively finds secrets in the current dir"
 }
 
-func (tracker *Tracker) FindAllPossibleKeys(files []string) {
-	for _, file := range files {
-		err := tracker.process(file)
-		if err != nil {
-			tracker.Ui.Error(err.Error())
-			continue
+// FindAllPossibleKeys scans the files using a pool of workers, the findings are sorted by file and line
+func (tracker *Tracker) FindAllPossibleKeys(files []string) ([]Finding, error) {
+	if err := tracker.loadRules(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		path     string
+		findings []Finding
+		err      error
+	}
+
+	workers := tracker.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	tracker.skipped = nil
+	paths := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				findings, err := tracker.process(path)
+				results <- result{path: path, findings: findings, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, file := range files {
+			paths <- file
 		}
+		close(paths)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Only this goroutine touches the ui and the findings
+	var findings []Finding
+	tracker.unread = 0
+	for result := range results {
+		// An archive can have both findings and entries that failed
+		if result.err != nil {
+			tracker.Ui.Error(result.err.Error())
+			tracker.unread++
+		}
+		findings = append(findings, result.findings...)
+	}
+
+	maxDepth, _ := tracker.archiveLimits()
+	sort.Strings(tracker.skipped)
+	for _, path := range tracker.skipped {
+		tracker.Ui.Warn(fmt.Sprintf("%s: not scanned, it is nested deeper than archives.maxDepth (%d)", path, maxDepth))
 	}
+
+	sortFindings(findings)
+	return findings, nil
 }
 
-func (tracker *Tracker) process(path string) error {
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
-		return errors.New("not yet implemented")
+func (tracker *Tracker) loadRules() error {
+	if tracker.rules != nil {
+		return nil
+	}
+
+	rules, err := compileRules(tracker.Cfg)
+	if err != nil {
+		return err
+	}
+	tracker.rules = rules
+	return nil
+}
+
+func (tracker *Tracker) process(path string) ([]Finding, error) {
+	if isUrl(path) {
+		return tracker.processUrl(path)
 	} else {
 		file, err := os.Open(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer file.Close()
 
-		scanner := bufio.NewScanner(file)
-		lineNumber := 0
-		for scanner.Scan() {
-			lineNumber++
-			text := strings.TrimSpace(scanner.Text())
-			split := strings.Split(text, " ")
-
-			keyword, seed := tracker.seed(text, path)
-			for _, word := range split {
-				entropy := shannonEntropy(word, seed)
-				if entropy > minimumEntropy {
-					tracker.Ui.Info("----------------------------------------------------------")
-					matches := matchesRegexp(word)
-					if len(matches) > 0 {
-						for _, match := range matches {
-							if strings.Contains(strings.ToLower(text), match) {
-								tracker.Ui.Info(fmt.Sprintf("Matched vendor: %s", match))
-							}
-						}
-					}
-					if keyword != "" {
-						tracker.Ui.Info(fmt.Sprintf("Matched keyword: %s", keyword))
-					}
-					tracker.Ui.Info(fmt.Sprintf("File: %s", path))
-					tracker.Ui.Info(fmt.Sprintf("Line: %d", lineNumber))
-					tracker.Ui.Info(fmt.Sprintf("Entropy: %f", entropy))
-					tracker.Ui.Info(fmt.Sprintf("Text: %s", text))
-				}
+		return tracker.processReader(path, file, 0)
+	}
+}
+
+// processReader descends into archives and compressed content, otherwise scans it line by line unless
+// it's binary. depth is the number of archives the content is nested in
+func (tracker *Tracker) processReader(path string, r io.Reader, depth int) ([]Finding, error) {
+	reader := bufio.NewReaderSize(r, util.SniffLength)
+	head, err := reader.Peek(util.SniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	if kind := archiveKind(head); kind != "" {
+		return tracker.processArchive(path, kind, reader, r, depth)
+	}
+
+	if util.IsBinary(head) {
+		return nil, nil
+	}
+
+	var findings []Finding
+	scanner := newLineScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		findings = append(findings, tracker.processLine(path, lineNumber, scanner.Text(), nil)...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return findings, err
+	}
+
+	return findings, nil
+}
+
+// processLine runs the entropy and vendor checks on the candidates in a single line, commit is nil unless
+// the line comes from the history of a repo
+func (tracker *Tracker) processLine(path string, lineNumber int, line string, commit *Commit) []Finding {
+	if strings.Contains(line, ignoreComment) {
+		return nil
+	}
+
+	var findings []Finding
+	ruleMatches := tracker.matchRules(line, strings.ToLower(line))
+	keyword, seed := tracker.seed(line, path)
+	for _, candidate := range extractCandidates(line) {
+		var matches []ruleMatch
+		var override *float64
+		for _, match := range ruleMatches {
+			if !match.overlaps(candidate) {
+				continue
+			}
+			matches = append(matches, match)
+			if match.entropy != nil && (override == nil || *match.entropy < *override) {
+				override = match.entropy
 			}
 		}
 
-		if err := scanner.Err(); err != nil {
-			return err
+		threshold := thresholds[candidate.charset]
+		if override != nil {
+			threshold = *override
 		}
 
-		return nil
+		entropy := shannonEntropy(candidate.value, seed)
+		if entropy > threshold {
+			finding := Finding{
+				Rule:     entropyRule,
+				Severity: defaultSeverity,
+				File:     path,
+				Line:     lineNumber,
+				Column:   candidate.start + 1,
+				Length:   len(candidate.value),
+				Charset:  candidate.charset,
+				Entropy:  entropy,
+				Keyword:  keyword,
+				Match:    redact(candidate.value),
+				Snippet:  redactCandidate(line, candidate),
+				Secret:   candidate.value,
+				Commit:   commit,
+			}
+			for _, match := range matches {
+				if !containsString(finding.Vendors, match.name) {
+					finding.Vendors = append(finding.Vendors, match.name)
+				}
+				if finding.Rule == entropyRule || severityRank(match.severity) > severityRank(finding.Severity) {
+					finding.Rule = match.name
+					finding.Severity = match.severity
+					finding.RuleMatch = line[match.start:match.end]
+				}
+			}
+			findings = append(findings, finding)
+		}
 	}
+	return findings
+}
+
+// lineScanner reads lines like bufio.Scanner but truncates lines longer than maxLineLength instead of
+// failing, one minified file mustn't end the scan
+type lineScanner struct {
+	reader *bufio.Reader
+	line   []byte
+	err    error
+}
+
+func newLineScanner(r io.Reader) *lineScanner {
+	return &lineScanner{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (s *lineScanner) Scan() bool {
+	s.line = s.line[:0]
+	for {
+		chunk, isPrefix, err := s.reader.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			// a line ending with the input is returned before io.EOF, only a read error lands here mid line
+			return false
+		}
+		if room := maxLineLength - len(s.line); room > 0 {
+			if len(chunk) > room {
+				chunk = chunk[:room]
+			}
+			s.line = append(s.line, chunk...)
+		}
+		if !isPrefix {
+			return true
+		}
+	}
+}
+
+func (s *lineScanner) Text() string {
+	return string(s.line)
+}
+
+func (s *lineScanner) Err() error {
+	return s.err
 }
 
 // Should be optimized
@@ -186,23 +495,34 @@ func shannonEntropy(s string, seed float64) float64 {
 		return entropy
 	}
 
-	for i := 0; i < 256; i++ {
-		px := float64(strings.Count(s, string(byte(i)))) / float64(len(s))
-		if px > 0 {
+	var histogram [256]int
+	for i := 0; i < len(s); i++ {
+		histogram[s[i]]++
+	}
+
+	length := float64(len(s))
+	for _, count := range histogram {
+		if count > 0 {
+			px := float64(count) / length
 			entropy += -px * math.Log2(px)
 		}
 	}
 	return entropy
 }
 
-func matchesRegexp(s string) []string {
-	var matches []string
-	for name, listOfRegexp := range keys {
-		for _, regex := range listOfRegexp {
-			if regex.MatchString(s) {
-				matches = append(matches, name)
-			}
-		}
+func (tracker *Tracker) matchRules(line string, lowerLine string) []ruleMatch {
+	var matches []ruleMatch
+	for _, rule := range tracker.rules {
+		matches = append(matches, rule.find(line, lowerLine)...)
 	}
 	return matches
 }
+
+func containsString(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package tracker_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/freddd/janitor/tracker"
+	"github.com/mitchellh/cli"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TrackerSuite")
+}
+
+var _ = Describe("TrackerSuite", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-tracker")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("returns the findings of all workers sorted by file and line", func() {
+		var files []string
+		for i := 0; i < 50; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("file%02d.env", i))
+			content := "A= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\nnothing to see here\nB= Qw7eRt5yUi3oPa1sDf9gHj8kLz6xCv4bNm2 C= Zt8pQ2mK9xWv4LbN7cRj3Hf6Gs1Ye5Da0Uo\n"
+			Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+			// Reverse order so that sorting actually matters
+			files = append([]string{path}, files...)
+		}
+
+		t := &tracker.Tracker{Ui: cli.NewMockUi(), Cfg: &config.Tracker{}, Workers: 8}
+		findings, err := t.FindAllPossibleKeys(files)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findings).To(HaveLen(150))
+
+		for i, finding := range findings {
+			Expect(filepath.Base(finding.File)).To(Equal(fmt.Sprintf("file%02d.env", i/3)))
+		}
+		Expect(findings[0].Line).To(Equal(1))
+		Expect(findings[1].Line).To(Equal(3))
+		Expect(findings[1].Column).To(Equal(4))
+		Expect(findings[2].Column).To(Equal(43))
+	})
+
+	It("reports unreadable files without failing the scan", func() {
+		path := filepath.Join(dir, "app.env")
+		Expect(ioutil.WriteFile(path, []byte("A= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\n"), 0644)).To(Succeed())
+
+		ui := cli.NewMockUi()
+		t := &tracker.Tracker{Ui: ui, Cfg: &config.Tracker{}}
+		findings, err := t.FindAllPossibleKeys([]string{filepath.Join(dir, "missing.env"), path})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findings).To(HaveLen(1))
+		Expect(ui.ErrorWriter.String()).To(ContainSubstring("missing.env"))
+	})
+
+	It("fails the run when a file or an archive entry can't be read", func() {
+		cfgPath := filepath.Join(dir, "janitor.yml")
+		Expect(ioutil.WriteFile(cfgPath, []byte("tracker:\n  archives:\n    maxSize: 1024\n"), 0644)).To(Succeed())
+		env := filepath.Join(dir, "app.env")
+		Expect(ioutil.WriteFile(env, []byte("A= hZ3kQ9xWm2Lp7VbN4tRy8Jc6Fd1Gs5Ea0Ku\n"), 0644)).To(Succeed())
+		archive := filepath.Join(dir, "app.zip")
+		Expect(ioutil.WriteFile(archive, zipOf(map[string][]byte{"big.txt": bytes.Repeat([]byte("a"), 2048)}), 0644)).To(Succeed())
+
+		run := func(targets ...string) (int, string) {
+			ui := cli.NewMockUi()
+			t := &tracker.Tracker{Ui: ui, Out: &bytes.Buffer{}}
+			return t.Run(append([]string{"-cfg", cfgPath}, targets...)), ui.ErrorWriter.String()
+		}
+
+		code, _ := run(env)
+		Expect(code).To(Equal(0))
+
+		code, errors := run(env, archive)
+		Expect(code).To(Equal(1))
+		Expect(errors).To(ContainSubstring("app.zip!/big.txt: exceeds the size limit"))
+
+		broken := filepath.Join(dir, "broken.gz")
+		Expect(ioutil.WriteFile(broken, []byte("\x1f\x8b\x08\x00garbage"), 0644)).To(Succeed())
+		code, errors = run(env, broken)
+		Expect(code).To(Equal(1))
+		Expect(errors).To(ContainSubstring("broken.gz"))
+	})
+})
@@ -0,0 +1,275 @@
+package tracker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/freddd/janitor/config"
+	"github.com/parnurzeal/gorequest"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	Verified string = "verified"
+	Invalid  string = "invalid"
+	Unknown  string = "unknown"
+
+	verifyTimeout = 10 * time.Second
+
+	defaultGitHubUrl = "https://api.github.com/"
+	defaultSlackUrl  = "https://slack.com/api/"
+	defaultAWSUrl    = "https://sts.amazonaws.com/"
+	defaultGoogleUrl = "https://maps.googleapis.com/"
+)
+
+var awsAccessKeyId = regexp.MustCompile(`(AKIA|ASIA)[0-9A-Z]{16}`)
+
+// Verifier checks if the secret of a finding is live, sameFile holds all findings in the same file for the
+// verifiers that need more than one part of a credential (like an aws key pair)
+type Verifier interface {
+	Verify(finding Finding, sameFile []Finding) (string, error)
+}
+
+// DefaultVerifiers returns the verifiers keyed by the rule name they verify
+func DefaultVerifiers(cfg config.Verify) map[string]Verifier {
+	return map[string]Verifier{
+		"github": &GitHubVerifier{BaseUrl: orDefault(cfg.GitHub, defaultGitHubUrl)},
+		"slack":  &SlackVerifier{BaseUrl: orDefault(cfg.Slack, defaultSlackUrl)},
+		"aws":    &AWSVerifier{BaseUrl: orDefault(cfg.AWS, defaultAWSUrl), Region: "us-east-1"},
+		"google": &GoogleVerifier{BaseUrl: orDefault(cfg.Google, defaultGoogleUrl)},
+	}
+}
+
+// verify tags every finding, a finding is tried against the verifier of each rule it matched
+func (tracker *Tracker) verify(findings []Finding) {
+	byFile := map[string][]Finding{}
+	for _, finding := range findings {
+		byFile[finding.File] = append(byFile[finding.File], finding)
+	}
+
+	for i := range findings {
+		findings[i].Verification = Unknown
+		for _, vendor := range findings[i].Vendors {
+			verifier, ok := tracker.Verifiers[vendor]
+			if !ok {
+				continue
+			}
+
+			status, err := verifier.Verify(findings[i], byFile[findings[i].File])
+			if err != nil {
+				tracker.Ui.Warn(fmt.Sprintf("Unable to verify %s secret in %s:%d: %s", vendor, findings[i].File, findings[i].Line, err))
+				continue
+			}
+			findings[i].Verification = status
+			if status != Unknown {
+				break
+			}
+		}
+	}
+}
+
+type GitHubVerifier struct {
+	BaseUrl string
+}
+
+func (v *GitHubVerifier) Verify(finding Finding, sameFile []Finding) (string, error) {
+	res, _, errs := gorequest.New().Timeout(verifyTimeout).
+		Get(v.BaseUrl+"user").
+		Set("Authorization", fmt.Sprintf("token %s", finding.token())).
+		End()
+	if len(errs) > 0 {
+		return Unknown, errs[0]
+	}
+
+	switch res.StatusCode {
+	case 200:
+		return Verified, nil
+	case 401:
+		return Invalid, nil
+	}
+	return Unknown, nil
+}
+
+type SlackVerifier struct {
+	BaseUrl string
+}
+
+func (v *SlackVerifier) Verify(finding Finding, sameFile []Finding) (string, error) {
+	res, body, errs := gorequest.New().Timeout(verifyTimeout).
+		Post(v.BaseUrl+"auth.test").
+		Set("Authorization", fmt.Sprintf("Bearer %s", finding.token())).
+		End()
+	if len(errs) > 0 {
+		return Unknown, errs[0]
+	}
+	if res.StatusCode != 200 {
+		return Unknown, nil
+	}
+
+	response := struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return Unknown, err
+	}
+
+	switch {
+	case response.Ok:
+		return Verified, nil
+	case response.Error == "invalid_auth" || response.Error == "not_authed" ||
+		response.Error == "account_inactive" || response.Error == "token_revoked":
+		return Invalid, nil
+	}
+	return Unknown, nil
+}
+
+type GoogleVerifier struct {
+	BaseUrl string
+}
+
+func (v *GoogleVerifier) Verify(finding Finding, sameFile []Finding) (string, error) {
+	query := url.Values{"address": {"Stockholm"}, "key": {finding.token()}}
+	res, body, errs := gorequest.New().Timeout(verifyTimeout).
+		Get(v.BaseUrl + "maps/api/geocode/json?" + query.Encode()).
+		End()
+	if len(errs) > 0 {
+		return Unknown, errs[0]
+	}
+	if res.StatusCode != 200 {
+		return Unknown, nil
+	}
+
+	response := struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return Unknown, err
+	}
+
+	switch {
+	case response.Status == "OK" || response.Status == "ZERO_RESULTS":
+		return Verified, nil
+	case response.Status == "REQUEST_DENIED" && strings.Contains(response.ErrorMessage, "invalid"):
+		return Invalid, nil
+	}
+	return Unknown, nil
+}
+
+// AWSVerifier calls sts:GetCallerIdentity, which every valid key pair is allowed to do. The access key id
+// is taken from the closest finding in the same file that looks like one
+type AWSVerifier struct {
+	BaseUrl string
+	Region  string
+}
+
+func (v *AWSVerifier) Verify(finding Finding, sameFile []Finding) (string, error) {
+	accessKeyId := closestAccessKeyId(finding, sameFile)
+	if accessKeyId == "" {
+		return Unknown, nil
+	}
+
+	target, err := url.Parse(v.BaseUrl)
+	if err != nil {
+		return Unknown, err
+	}
+	target.RawQuery = "Action=GetCallerIdentity&Version=2011-06-15"
+	if target.Path == "" {
+		target.Path = "/"
+	}
+
+	now := time.Now().UTC()
+	res, body, errs := gorequest.New().Timeout(verifyTimeout).
+		Get(target.String()).
+		Set("X-Amz-Date", now.Format("20060102T150405Z")).
+		Set("Authorization", signV4(target, accessKeyId, finding.token(), v.Region, "sts", now)).
+		End()
+	if len(errs) > 0 {
+		return Unknown, errs[0]
+	}
+
+	switch {
+	case res.StatusCode == 200:
+		return Verified, nil
+	case res.StatusCode == 403 && (strings.Contains(body, "InvalidClientTokenId") || strings.Contains(body, "SignatureDoesNotMatch")):
+		return Invalid, nil
+	}
+	return Unknown, nil
+}
+
+func closestAccessKeyId(finding Finding, sameFile []Finding) string {
+	if id := awsAccessKeyId.FindString(finding.Snippet); id != "" {
+		return id
+	}
+
+	closest := ""
+	distance := -1
+	for _, other := range sameFile {
+		id := awsAccessKeyId.FindString(other.token())
+		if id == "" {
+			continue
+		}
+		d := other.Line - finding.Line
+		if d < 0 {
+			d = -d
+		}
+		if distance < 0 || d < distance {
+			closest = id
+			distance = d
+		}
+	}
+	return closest
+}
+
+// signV4 returns the Authorization header of a GET request without a body signed with AWS Signature V4
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signV4(target *url.URL, accessKeyId string, secretKey string, region string, service string, now time.Time) string {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		target.EscapedPath(),
+		target.RawQuery,
+		fmt.Sprintf("host:%s\nx-amz-date:%s\n", target.Host, amzDate),
+		"host;x-amz-date",
+		fmt.Sprintf("%x", sha256.Sum256([]byte{})),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		fmt.Sprintf("%x", sha256.Sum256([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-date, Signature=%x",
+		accessKeyId, scope, hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	if !strings.HasSuffix(value, "/") {
+		value += "/"
+	}
+	return value
+}
@@ -0,0 +1,203 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SniffLength is how much of the content IsBinary looks at
+const SniffLength int = 8000
+
+// IgnoreFiles are read in every directory while walking, they use the .gitignore syntax
+var IgnoreFiles = []string{".gitignore", ".janitorignore"}
+
+type pattern struct {
+	// base is the slash separated dir (relative to the root) of the file the pattern was read from
+	base    string
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Ignore matches paths relative to the root against .gitignore style patterns, the last matching
+// pattern decides if the path is ignored
+type Ignore struct {
+	patterns []pattern
+}
+
+// NewIgnore creates an Ignore from patterns that are relative to the root
+func NewIgnore(patterns []string) *Ignore {
+	ignore := &Ignore{}
+	ignore.Add("", patterns)
+	return ignore
+}
+
+// Add appends the patterns read from a file in the base dir, they take precedence over earlier patterns
+func (ignore *Ignore) Add(base string, lines []string) {
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p := pattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// A pattern without a slash matches at any depth, otherwise it's relative to the base
+		prefix := "^(?:.*/)?"
+		if strings.Contains(line, "/") {
+			prefix = "^"
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		regex, err := regexp.Compile(prefix + globToRegexp(line) + "$")
+		if err != nil {
+			continue
+		}
+		p.regex = regex
+		ignore.patterns = append(ignore.patterns, p)
+	}
+}
+
+// AddFile reads the patterns from path, a missing file is not an error
+func (ignore *Ignore) AddFile(base string, path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	ignore.Add(base, lines)
+	return nil
+}
+
+// Matches returns true if rel (slash separated, relative to the root) itself is ignored
+func (ignore *Ignore) Matches(rel string, isDir bool) bool {
+	_, ignored := ignore.match(rel, isDir)
+	return ignored
+}
+
+// match also returns if any pattern matched at all, so that a negated pattern can override another Ignore
+func (ignore *Ignore) match(rel string, isDir bool) (bool, bool) {
+	matched := false
+	ignored := false
+	if ignore == nil {
+		return matched, ignored
+	}
+
+	for _, p := range ignore.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+
+		target := rel
+		if p.base != "" {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, p.base+"/")
+		}
+
+		if p.regex.MatchString(target) {
+			matched = true
+			ignored = !p.negate
+		}
+	}
+	return matched, ignored
+}
+
+// MatchesPath returns true if rel or any of its parent dirs is ignored, useful when the path isn't
+// found by walking the tree
+func (ignore *Ignore) MatchesPath(rel string) bool {
+	if dir := path.Dir(rel); dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			if ignore.Matches(strings.Join(parts[:i+1], "/"), true) {
+				return true
+			}
+		}
+	}
+	return ignore.Matches(rel, false)
+}
+
+func globToRegexp(glob string) string {
+	var regex bytes.Buffer
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			regex.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			regex.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			regex.WriteString(".*")
+			i++
+		case c == '*':
+			regex.WriteString("[^/]*")
+		case c == '?':
+			regex.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				regex.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			regex.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			regex.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			regex.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return regex.String()
+}
+
+// IsBinary uses the same heuristic as git, a NUL byte in the first few kb means the content is binary
+func IsBinary(head []byte) bool {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	for _, b := range head {
+		if b == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -1,27 +1,112 @@
 package util
 
 import (
-	"path/filepath"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-func FindAllFiles(dir string, ignoreDirs []string) ([]string, error) {
+// WalkErrors are the paths that couldn't be read while walking a tree, like a directory without permission
+type WalkErrors []error
+
+func (errs WalkErrors) Error() string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// FindAllFiles walks dir and returns every file that isn't ignored, ignorePatterns use the .gitignore
+// syntax and take precedence over the IgnoreFiles found in the tree. Unreadable paths don't stop the walk,
+// they are returned as WalkErrors along with the files that were found
+func FindAllFiles(dir string, ignorePatterns []string) ([]string, error) {
+	var files []string
+	var walkErrors WalkErrors
+	fromFiles := &Ignore{}
+	fromConfig := NewIgnore(ignorePatterns)
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			// the subtree of a directory that can't be read is skipped
+			walkErrors = append(walkErrors, err)
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "." {
+			isDir := f.Mode().IsDir()
+			ignored := fromFiles.Matches(rel, isDir)
+			if matched, ignoredByConfig := fromConfig.match(rel, isDir); matched {
+				ignored = ignoredByConfig
+			}
+
+			if ignored {
+				if isDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if f.Mode().IsDir() {
+			base := rel
+			if base == "." {
+				base = ""
+			}
+			for _, name := range IgnoreFiles {
+				if err := fromFiles.AddFile(base, filepath.Join(path, name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if f.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	if err == nil && len(walkErrors) > 0 {
+		err = walkErrors
+	}
+	return files, err
+}
+
+// FindAllFilesSkipping walks dir and returns every file whose path doesn't contain one of ignoreDirs, like
+// vendor. Unlike FindAllFiles there are no patterns and the ignore files in the tree aren't read
+func FindAllFilesSkipping(dir string, ignoreDirs []string) ([]string, error) {
 	var files []string
+	var walkErrors WalkErrors
 	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		ignore := false
-		for _, dir := range ignoreDirs {
-			if strings.Contains(path, dir) {
-				ignore = true
+		if err != nil {
+			walkErrors = append(walkErrors, err)
+			return nil
+		}
+
+		for _, ignoreDir := range ignoreDirs {
+			if strings.Contains(path, ignoreDir) {
+				if f.Mode().IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
 			}
 		}
 
-		if !f.Mode().IsDir() && !ignore {
+		if f.Mode().IsRegular() {
 			files = append(files, path)
 		}
 		return nil
 	})
 
+	if err == nil && len(walkErrors) > 0 {
+		err = walkErrors
+	}
 	return files, err
 }
 
@@ -31,4 +116,4 @@ func CurrentDir() (string, error) {
 		return "", err
 	}
 	return pwd, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,125 @@
+package util_test
+
+import (
+	"github.com/freddd/janitor/util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestUtil(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "UtilSuite")
+}
+
+var _ = Describe("UtilSuite", func() {
+	var dir string
+
+	write := func(rel string, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	relative := func(files []string) []string {
+		var rel []string
+		for _, file := range files {
+			r, err := filepath.Rel(dir, file)
+			Expect(err).NotTo(HaveOccurred())
+			rel = append(rel, filepath.ToSlash(r))
+		}
+		sort.Strings(rel)
+		return rel
+	}
+
+	find := func(patterns ...string) []string {
+		files, err := util.FindAllFiles(dir, patterns)
+		Expect(err).NotTo(HaveOccurred())
+		return relative(files)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "janitor-util")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("skips the paths containing one of the names without reading ignore files for mining", func() {
+		write(".gitignore", "*.log\n")
+		write("app.log", "")
+		write("vendor/lib.go", "")
+		write("pkg/vendored.go", "")
+		write("main.go", "")
+
+		files, err := util.FindAllFilesSkipping(dir, []string{"vendor"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relative(files)).To(Equal([]string{".gitignore", "app.log", "main.go"}))
+	})
+
+	It("uses glob semantics for the ignore patterns", func() {
+		write(".git/config", "")
+		write("app.js", "")
+		write("app.min.js", "")
+		write("docs/.github/readme", "")
+		write("a/b/c/secret.pem", "")
+
+		Expect(find(".git/", "*.min.*", "a/**/*.pem")).To(Equal([]string{"app.js", "docs/.github/readme"}))
+	})
+
+	It("honours ignore files found in the tree", func() {
+		write(".gitignore", "*.log\nbuild/\n")
+		write("debug.log", "")
+		write("build/out.txt", "")
+		write("sub/.janitorignore", "/fixtures\n!keep.log\n")
+		write("sub/fixtures/key.txt", "")
+		write("sub/keep.log", "")
+		write("sub/other/fixtures/key.txt", "")
+
+		Expect(find()).To(Equal([]string{".gitignore", "sub/.janitorignore", "sub/keep.log", "sub/other/fixtures/key.txt"}))
+	})
+
+	It("lets the patterns override the ignore files", func() {
+		write(".gitignore", "*.env\n")
+		write("prod.env", "")
+
+		Expect(find("!prod.env")).To(Equal([]string{".gitignore", "prod.env"}))
+	})
+
+	It("reports paths it can't read and keeps walking", func() {
+		_, err := util.FindAllFiles(filepath.Join(dir, "missing"), nil)
+		Expect(err).To(BeAssignableToTypeOf(util.WalkErrors{}))
+		Expect(err.Error()).To(ContainSubstring("no such file or directory"))
+
+		if os.Geteuid() == 0 {
+			Skip("root can read every directory")
+		}
+		write("locked/key.txt", "")
+		write("open/key.txt", "")
+		Expect(os.Chmod(filepath.Join(dir, "locked"), 0)).To(Succeed())
+		defer os.Chmod(filepath.Join(dir, "locked"), 0755)
+
+		files, err := util.FindAllFiles(dir, nil)
+		Expect(err).To(MatchError(ContainSubstring("permission denied")))
+		Expect(files).To(Equal([]string{filepath.Join(dir, "open/key.txt")}))
+	})
+
+	It("matches parent dirs of a path", func() {
+		ignore := util.NewIgnore([]string{"vendor", "*.min.*"})
+		Expect(ignore.MatchesPath("vendor/github.com/x/y.go")).To(BeTrue())
+		Expect(ignore.MatchesPath("static/app.min.js")).To(BeTrue())
+		Expect(ignore.MatchesPath("cmd/vendored.go")).To(BeFalse())
+	})
+
+	It("detects binary content", func() {
+		Expect(util.IsBinary([]byte("password = hunter2\n"))).To(BeFalse())
+		Expect(util.IsBinary([]byte{0x7f, 'E', 'L', 'F', 0x02, 0x01, 0x00})).To(BeTrue())
+	})
+})